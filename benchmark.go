@@ -0,0 +1,68 @@
+package whoistest
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/domainr/whois"
+)
+
+// Benchmark benchmarks parse over the responses in the embedded corpus
+// matching filters. See (*Corpus).Benchmark.
+func Benchmark(b *testing.B, parse ParseFunc, filters ...Filter) {
+	b.Helper()
+	c, err := NewCorpus()
+	if err != nil {
+		b.Fatal(err)
+	}
+	c.Benchmark(b, parse, filters...)
+}
+
+// Benchmark benchmarks parse over the whois responses in c matching filters,
+// in a sub-benchmark named all that parses every response once per op,
+// and a sub-benchmark per host that parses that host's responses.
+// Besides the usual ns/op, B/op and allocs/op, each reports ns/response,
+// B/response and allocs/response, which are comparable across hosts with
+// different numbers of responses.
+// Errors returned by parse are ignored, since parsers often reject some
+// responses, e.g. rate limit notices.
+func (c *Corpus) Benchmark(b *testing.B, parse ParseFunc, filters ...Filter) {
+	c = c.Filter(whoisOnly(filters)...)
+	b.Run("all", func(b *testing.B) {
+		benchmarkResponses(b, parse, c.Responses())
+	})
+	for _, host := range c.Hosts() {
+		rs := c.Responses(Host(host))
+		b.Run(host, func(b *testing.B) {
+			benchmarkResponses(b, parse, rs)
+		})
+	}
+}
+
+func benchmarkResponses(b *testing.B, parse ParseFunc, rs []*whois.Response) {
+	if len(rs) == 0 {
+		b.Skip("no responses")
+	}
+	var size int64
+	for _, res := range rs {
+		size += int64(len(res.Body))
+	}
+	b.SetBytes(size)
+	b.ReportAllocs()
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, res := range rs {
+			parse(res)
+		}
+	}
+	b.StopTimer()
+	runtime.ReadMemStats(&after)
+
+	n := float64(b.N) * float64(len(rs))
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/n, "ns/response")
+	b.ReportMetric(float64(after.TotalAlloc-before.TotalAlloc)/n, "B/response")
+	b.ReportMetric(float64(after.Mallocs-before.Mallocs)/n, "allocs/response")
+}
@@ -0,0 +1,18 @@
+package whoistest
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/domainr/whois"
+)
+
+// parseLines is a trivial ParseFunc that splits the body into lines.
+func parseLines(res *whois.Response) (*Result, error) {
+	lines := bytes.Split(res.Body, []byte("\n"))
+	return &Result{Domain: string(lines[0])}, nil
+}
+
+func BenchmarkParseLines(b *testing.B) {
+	Benchmark(b, parseLines, Zone("kr", "jp"))
+}
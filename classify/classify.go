@@ -0,0 +1,219 @@
+// Package classify tokenizes whois responses into classified lines:
+// empty lines, status messages, notices, keys and values, and free text.
+package classify
+
+import (
+	"bufio"
+	"regexp"
+	"strings"
+
+	"github.com/domainr/whois"
+)
+
+// Class is the classification of a line of whois response text.
+type Class int
+
+// Line classes.
+const (
+	Text        Class = iota // Unclassified text
+	Empty                    // Blank line
+	NotFound                 // Query not found, e.g. "No match for ..."
+	Unavailable              // Domain not available for registration, e.g. reserved
+	Notice                   // Comment, disclaimer or legal notice
+	AltKeyValue              // [Key] Value
+	BareAltKey               // [Key]
+	KeyValue                 // Key: Value
+	BareKey                  // Key:
+	BareValue                // Indented value continuing a preceding key
+)
+
+var classNames = [...]string{
+	Text:        "TEXT",
+	Empty:       "EMPTY",
+	NotFound:    "NOT_FOUND",
+	Unavailable: "UNAVAILABLE",
+	Notice:      "NOTICE",
+	AltKeyValue: "ALT_KEY_VALUE",
+	BareAltKey:  "BARE_ALT_KEY",
+	KeyValue:    "KEY_VALUE",
+	BareKey:     "BARE_KEY",
+	BareValue:   "BARE_VALUE",
+}
+
+// String returns the name of c, e.g. KEY_VALUE.
+func (c Class) String() string {
+	if c < 0 || int(c) >= len(classNames) {
+		return "UNKNOWN"
+	}
+	return classNames[c]
+}
+
+// Line is a classified line of whois response text.
+type Line struct {
+	Number int    // 1-based line number within the response body
+	Class  Class  // Classification
+	Key    string // Key, for key classes
+	Value  string // Value, for value classes
+	Text   string // Original line text
+}
+
+var (
+	reEmptyLine = regexp.MustCompile(`^\s*$`)
+
+	reKey         = `([^,a-z\:\],][^\:\]]{0,39}\S|[a-z-]{3,40})`
+	reLeader      = `(?:\.{2,})?`        // Dot leader, e.g. "domain.......: " (whois.fi)
+	reListMarker  = `(?:[a-z]\.[ \t]+)?` // List marker, e.g. "a. [Domain Name]" (whois.jprs.jp)
+	reBareKey     = regexp.MustCompile(`^[ \t]{0,3}` + reKey + reLeader + `\s*\:\s*$`)
+	reKeyValue    = regexp.MustCompile(`^[ \t]{0,3}` + reKey + reLeader + `\s*\:\s*(.*\S)\s*$`)
+	reAltKey      = regexp.MustCompile(`^` + reListMarker + `\[` + reKey + `\]\s*$`)
+	reAltKeyValue = regexp.MustCompile(`^` + reListMarker + `\[` + reKey + `\]\s*(.*\S)\s*$`)
+	reBareValue   = regexp.MustCompile(`^      \s+(.*\S)\s*$`)
+
+	reUnavailable = regexp.MustCompile(strings.Join([]string{
+		`^Above domain name is not available for registration\.$`,
+	}, "|"))
+
+	reReserved = regexp.MustCompile(strings.Join([]string{
+		`^Domain reserved$`,
+		`^the domain you want to register is reserved\.$`,  // whois.cnnic.cn
+		`^This request domain name is restricted to .+\.$`, // whois.kr
+		`^% reserved:\s+\S+$`,                              // whois.registro.br
+	}, "|"))
+
+	reNotFound = regexp.MustCompile(strings.Join([]string{
+		`^No match\!\!$`,
+		`^NOT FOUND$`,
+		`^no matching record.$`,
+		`^Not found\: .+$`,
+		`^\s*No match for "([^"]+)"\.$`,
+		`^No Data Found$`,
+		`^Domain not found$`,
+		`^The requested domain was not found in the Registry`,
+		`^% No match for domain "([^"]+)"$`,
+		`^% No entries found for query "([^"]+)"\.$`,
+		`^Domain (\S+) is available for purchase$`,
+		`^%% No entries found in the .+ Database\.$`,
+		`^Above domain name is not registered to [^\.]+\.$`,
+	}, "|"))
+
+	reNotice = regexp.MustCompile(strings.Join([]string{
+		`^%`,                // whois.de, whois.registro.br
+		`^# `,               // whois.kr
+		`^\[ .+ \]$`,        // whois.jprs.jp
+		`^>>>.+<<<$`,        // Database last updated...
+		`^[^\:]+https?\://`, // Line with an URL
+		`^NOTE: |^NOTICE: |^TERMS OF USE: `,
+	}, "|"))
+)
+
+// Scanner reads classified lines from a whois response.
+// Successive calls to Scan step through the lines of the response body.
+type Scanner struct {
+	// Known reports whether a candidate key is recognized. Lines whose
+	// key is not known fall through to the BareValue and Text classes.
+	// It defaults to IsKnownKey.
+	Known func(key string) bool
+
+	s    *bufio.Scanner
+	line Line
+}
+
+// NewScanner returns a new Scanner reading the UTF-8 text of res.
+func NewScanner(res *whois.Response) (*Scanner, error) {
+	r, err := res.Reader()
+	if err != nil {
+		return nil, err
+	}
+	return &Scanner{Known: IsKnownKey, s: bufio.NewScanner(r)}, nil
+}
+
+// Scan advances to the next line, which is then available through Line.
+// It returns false at the end of the response or on error.
+func (s *Scanner) Scan() bool {
+	if !s.s.Scan() {
+		return false
+	}
+	s.line = s.classify(s.line.Number+1, s.s.Text())
+	return true
+}
+
+// Line returns the most recent line read by Scan.
+func (s *Scanner) Line() Line {
+	return s.line
+}
+
+// Err returns the first non-EOF error encountered by the Scanner.
+func (s *Scanner) Err() error {
+	return s.s.Err()
+}
+
+func (s *Scanner) known(k string) bool {
+	if s.Known == nil {
+		return IsKnownKey(k)
+	}
+	return s.Known(k)
+}
+
+func (s *Scanner) classify(n int, text string) Line {
+	l := Line{Number: n, Text: text}
+
+	// Empty lines
+	if reEmptyLine.MatchString(text) {
+		l.Class = Empty
+		return l
+	}
+
+	// Status messages
+	if reNotFound.MatchString(text) {
+		l.Class = NotFound
+		return l
+	}
+	if reUnavailable.MatchString(text) || reReserved.MatchString(text) {
+		l.Class = Unavailable
+		return l
+	}
+
+	// Notices
+	if reNotice.MatchString(text) {
+		l.Class = Notice
+		return l
+	}
+
+	// Keys and values
+	if m := reAltKeyValue.FindStringSubmatch(text); m != nil && s.known(m[1]) {
+		l.Class, l.Key, l.Value = AltKeyValue, m[1], m[2]
+		return l
+	}
+	if m := reAltKey.FindStringSubmatch(text); m != nil && s.known(m[1]) {
+		l.Class, l.Key = BareAltKey, m[1]
+		return l
+	}
+	if m := reKeyValue.FindStringSubmatch(text); m != nil && s.known(m[1]) {
+		l.Class, l.Key, l.Value = KeyValue, m[1], m[2]
+		return l
+	}
+	if m := reBareKey.FindStringSubmatch(text); m != nil && s.known(m[1]) {
+		l.Class, l.Key = BareKey, m[1]
+		return l
+	}
+	if m := reBareValue.FindStringSubmatch(text); m != nil {
+		l.Class, l.Value = BareValue, m[1]
+		return l
+	}
+
+	// Text (unknown)
+	return l
+}
+
+// Lines returns the classified lines of res.
+func Lines(res *whois.Response) ([]Line, error) {
+	s, err := NewScanner(res)
+	if err != nil {
+		return nil, err
+	}
+	var lines []Line
+	for s.Scan() {
+		lines = append(lines, s.Line())
+	}
+	return lines, s.Err()
+}
@@ -0,0 +1,195 @@
+package classify
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/domainr/whois"
+	"github.com/domainr/whoistest"
+	"github.com/nbio/st"
+)
+
+func TestLines(t *testing.T) {
+	res := whois.NewResponse("example.com", "whois.example.com")
+	res.Body = []byte("% Terms of use\n" +
+		"\n" +
+		"Domain Name: EXAMPLE.COM\n" +
+		"Name Server:\n" +
+		"        A.IANA-SERVERS.NET\n" +
+		"[Registrant] Example Org\n" +
+		"Flavor: Vanilla\n" +
+		"No match for \"EXAMPLE.NET\".\n" +
+		"Domain reserved\n")
+	lines, err := Lines(res)
+	st.Assert(t, err, nil)
+	st.Assert(t, len(lines), 9)
+
+	expected := []struct {
+		class      Class
+		key, value string
+	}{
+		{Notice, "", ""},
+		{Empty, "", ""},
+		{KeyValue, "Domain Name", "EXAMPLE.COM"},
+		{BareKey, "Name Server", ""},
+		{BareValue, "", "A.IANA-SERVERS.NET"},
+		{AltKeyValue, "Registrant", "Example Org"},
+		{Text, "", ""},
+		{NotFound, "", ""},
+		{Unavailable, "", ""},
+	}
+	for i, e := range expected {
+		st.Expect(t, lines[i].Number, i+1)
+		st.Expect(t, lines[i].Class, e.class)
+		st.Expect(t, lines[i].Key, e.key)
+		st.Expect(t, lines[i].Value, e.value)
+	}
+}
+
+func TestLinesKeyFormats(t *testing.T) {
+	res := whois.NewResponse("example.fi", "whois.example.com")
+	res.Body = []byte("domain.............: example.fi\n" +
+		"nserver............: ns1.example.fi [OK]\n" +
+		"a. [ドメイン名]                 EXAMPLE.CO.JP\n" +
+		"p. [ネームサーバ]               ns1.example.jp\n" +
+		"[Domain Name]                   EXAMPLE.JP\n")
+	lines, err := Lines(res)
+	st.Assert(t, err, nil)
+	st.Assert(t, len(lines), 5)
+	expected := []struct {
+		class      Class
+		key, value string
+	}{
+		{KeyValue, "domain", "example.fi"},
+		{KeyValue, "nserver", "ns1.example.fi [OK]"},
+		{AltKeyValue, "ドメイン名", "EXAMPLE.CO.JP"},
+		{AltKeyValue, "ネームサーバ", "ns1.example.jp"},
+		{AltKeyValue, "Domain Name", "EXAMPLE.JP"},
+	}
+	for i, e := range expected {
+		st.Expect(t, lines[i].Class, e.class)
+		st.Expect(t, lines[i].Key, e.key)
+		st.Expect(t, lines[i].Value, e.value)
+	}
+}
+
+func TestLinesMessages(t *testing.T) {
+	for _, tt := range []struct {
+		text  string
+		class Class
+	}{
+		{`No match for "EXAMPLE.NET".`, NotFound},
+		{`    No match for "example.co.uk".`, NotFound}, // whois.nic.uk
+		{`No Data Found`, NotFound},                     // whois.nic.co, whois.registry.in
+		{`Domain not found`, NotFound},                  // whois.fi
+		{`The requested domain was not found in the Registry or Registrar’s WHOIS Server.`, NotFound}, // whois.kr
+		{`Domain not found in cache`, Text},
+		{`Domain reserved`, Unavailable},
+		{`the domain you want to register is reserved.`, Unavailable},                                  // whois.cnnic.cn
+		{`This request domain name is restricted to specifically qualified registrants.`, Unavailable}, // whois.kr
+		{`% reserved:    CG`, Unavailable},                                                             // whois.registro.br
+	} {
+		res := whois.NewResponse("example.com", "whois.example.com")
+		res.Body = []byte(tt.text + "\n")
+		lines, err := Lines(res)
+		st.Assert(t, err, nil)
+		st.Assert(t, len(lines), 1)
+		if lines[0].Class != tt.class {
+			t.Errorf("%q: got %s, want %s", tt.text, lines[0].Class, tt.class)
+		}
+	}
+}
+
+// TestCorpusMessages checks recorded responses whose not-found or
+// reserved messages are host-specific.
+func TestCorpusMessages(t *testing.T) {
+	c, err := whoistest.NewCorpus()
+	st.Assert(t, err, nil)
+	for _, tt := range []struct {
+		host, query string
+		class       Class
+	}{
+		{"whois.nic.uk", "zx5v7d4v2k50l3pq.co.uk", NotFound},
+		{"whois.nic.co", "zx5v7d4v2k50l3pq.co", NotFound},
+		{"whois.registry.in", "zx5v7d4v2k50l3pq.in", NotFound},
+		{"whois.fi", "zx5v7d4v2k50l3pq.fi", NotFound},
+		{"whois.kr", "zx5v7d4v2k50l3pq.kr", NotFound},
+		{"whois.kr", "nic.kr", Unavailable},
+		{"whois.cnnic.cn", "nic.cn", Unavailable},
+	} {
+		rs := c.Responses(whoistest.Host(tt.host), whoistest.Query(tt.query))
+		st.Assert(t, len(rs), 1)
+		lines, err := Lines(rs[0])
+		st.Assert(t, err, nil)
+		var found bool
+		for _, l := range lines {
+			found = found || l.Class == tt.class
+		}
+		if !found {
+			t.Errorf("%s/%s: no %s line", tt.host, tt.query, tt.class)
+		}
+	}
+}
+
+func TestScannerKnown(t *testing.T) {
+	res := whois.NewResponse("example.com", "whois.example.com")
+	res.Body = []byte("Flavor: Vanilla\n")
+	s, err := NewScanner(res)
+	st.Assert(t, err, nil)
+	var unknown []string
+	s.Known = func(k string) bool {
+		unknown = append(unknown, k)
+		return true
+	}
+	st.Assert(t, s.Scan(), true)
+	st.Expect(t, s.Line().Class, KeyValue)
+	st.Expect(t, unknown, []string{"Flavor"})
+	st.Expect(t, s.Scan(), false)
+	st.Expect(t, s.Err(), nil)
+}
+
+func TestNormalizeKey(t *testing.T) {
+	st.Expect(t, NormalizeKey("Admin E-mail"), "ADMIN_E_MAIL")
+	st.Expect(t, NormalizeKey(" Registrant  Postal Code: "), "REGISTRANT_POSTAL_CODE")
+	st.Expect(t, IsKnownKey("Registry Expiry Date"), true)
+	st.Expect(t, IsKnownKey("Flavor"), false)
+}
+
+func TestClassString(t *testing.T) {
+	st.Expect(t, KeyValue.String(), "KEY_VALUE")
+	st.Expect(t, Class(-1).String(), "UNKNOWN")
+}
+
+func TestCorpus(t *testing.T) {
+	c, err := whoistest.NewCorpus()
+	st.Assert(t, err, nil)
+	for _, res := range c.Responses(whoistest.Query("google.com")) {
+		lines, err := Lines(res)
+		st.Assert(t, err, nil)
+		st.Expect(t, lines[0].Class, KeyValue)
+		st.Expect(t, lines[0].Value, "GOOGLE.COM")
+	}
+}
+
+func TestField(t *testing.T) {
+	f, ok := Field("Registry Expiry Date")
+	st.Expect(t, ok, true)
+	st.Expect(t, f, "dates.expires")
+	f, ok = Field("Admin Email")
+	st.Expect(t, ok, true)
+	st.Expect(t, f, "contacts.admin.email")
+	_, ok = Field("Flavor")
+	st.Expect(t, ok, false)
+	st.Expect(t, DefaultFields().Version, 1)
+	st.Expect(t, DefaultFields().Keys("dates.transferred"), []string{"LAST_TRANSFERRED_DATE"})
+}
+
+func TestReadFieldMap(t *testing.T) {
+	m, err := ReadFieldMap(strings.NewReader(`{"version":1,"fields":{"FLAVOR":"flavor"}}`))
+	st.Assert(t, err, nil)
+	f, ok := m.Field("flavor")
+	st.Expect(t, ok, true)
+	st.Expect(t, f, "flavor")
+	_, err = ReadFieldMap(strings.NewReader(`{"version":2}`))
+	st.Refute(t, err, nil)
+}
@@ -0,0 +1,105 @@
+package classify
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/domainr/whoistest"
+)
+
+var (
+	reStrip = regexp.MustCompile(`[[:punct:]]`)
+	reSpace = regexp.MustCompile(`\s+`)
+)
+
+// NormalizeKey normalizes a whois key for lookup, e.g. "Admin E-mail"
+// becomes ADMIN_E_MAIL.
+func NormalizeKey(k string) string {
+	k = strings.ToUpper(k)
+	k = reStrip.ReplaceAllLiteralString(k, " ")
+	k = strings.TrimSpace(k)
+	k = reSpace.ReplaceAllLiteralString(k, "_")
+	return k
+}
+
+// IsKnownKey reports whether k, once normalized, is a known whois key.
+func IsKnownKey(k string) bool {
+	_, ok := Field(k)
+	return ok
+}
+
+// Field returns the canonical schema field for whois key k, and whether
+// k is known. See FieldMap for the field syntax.
+func Field(k string) (string, bool) {
+	return DefaultFields().Field(k)
+}
+
+// FieldMap maps normalized whois keys to canonical schema fields.
+//
+// Fields are dotted paths into the JSON encoding of a whoistest.Result,
+// e.g. dates.expires or contacts.admin.email, extended with fields the
+// Result does not hold, e.g. dnssec.ds[].digest. A [] suffix marks a
+// repeated field, such as nameservers[]. A * role, as in contacts.*.email,
+// marks a contact field whose role comes from the enclosing block.
+// Fields under section. mark headings that open a block of lines.
+type FieldMap struct {
+	Version int               `json:"version"`
+	Fields  map[string]string `json:"fields"`
+}
+
+// Field returns the canonical field for whois key k, and whether k is known.
+func (m *FieldMap) Field(k string) (string, bool) {
+	f, ok := m.Fields[NormalizeKey(k)]
+	return f, ok
+}
+
+// Keys returns the sorted normalized keys that map to field.
+func (m *FieldMap) Keys(field string) []string {
+	var keys []string
+	for k, f := range m.Fields {
+		if f == field {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ReadFieldMap reads a JSON-encoded FieldMap from r.
+func ReadFieldMap(r io.Reader) (*FieldMap, error) {
+	var m FieldMap
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, err
+	}
+	if m.Version != 1 {
+		return nil, fmt.Errorf("unsupported field map version %d", m.Version)
+	}
+	return &m, nil
+}
+
+var (
+	defaultFields     *FieldMap
+	defaultFieldsOnce sync.Once
+)
+
+// DefaultFields returns the field map in testdata/fields.json,
+// as embedded in package whoistest.
+// It panics if the file cannot be read.
+func DefaultFields() *FieldMap {
+	defaultFieldsOnce.Do(func() {
+		f, err := whoistest.Testdata().Open("fields.json")
+		if err != nil {
+			panic(fmt.Sprintf("classify: %v", err))
+		}
+		defer f.Close()
+		if defaultFields, err = ReadFieldMap(f); err != nil {
+			panic(fmt.Sprintf("classify: fields.json: %v", err))
+		}
+	})
+	return defaultFields
+}
@@ -0,0 +1,102 @@
+package classify
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/domainr/whois"
+	"github.com/domainr/whoistest"
+)
+
+var (
+	reRateLimited = regexp.MustCompile(`(?i)` + strings.Join([]string{
+		`limit exceeded`,
+		`exceeded .*limit`,
+		`too many (requests|queries|connections)`,
+		`access control limit reached`,
+		`please slow down`,
+	}, "|"))
+
+	reFailed = regexp.MustCompile(`(?i)` + strings.Join([]string{
+		`access denied`,
+		`connection refused`,
+		`not authori[sz]ed to access`,
+		`invalid syntax`,
+		`^error\b`,
+	}, "|"))
+)
+
+// Outcome detects the outcome of the whois query answered by res.
+// Text responses are classified by their lines: rate limit and error
+// messages, then not-found and reserved messages, then domain keys.
+// RDAP responses are classified by their error code and object class.
+func Outcome(res *whois.Response) whoistest.Outcome {
+	if len(res.Body) == 0 {
+		return whoistest.Failed
+	}
+	if res.MediaType == whoistest.RDAPMediaType {
+		return rdapOutcome(res)
+	}
+	if res.MediaType != "text/plain" {
+		return whoistest.Unknown
+	}
+	lines, err := Lines(res)
+	if err != nil {
+		return whoistest.Failed
+	}
+	var reserved, registered bool
+	var block string // Field of the last bare key, for bare values
+	for _, l := range lines {
+		if l.Class == BareKey || l.Class == BareAltKey {
+			block, _ = Field(l.Key)
+		}
+		switch {
+		case reRateLimited.MatchString(l.Text):
+			return whoistest.RateLimited
+		case l.Class == NotFound:
+			return whoistest.NotFound
+		case l.Class == Unavailable:
+			reserved = true
+		case l.Class == BareValue:
+			registered = registered || block == "domain"
+		case l.Key != "":
+			if f, _ := Field(l.Key); f == "domain" && l.Value != "" {
+				registered = true
+			}
+		}
+	}
+	switch {
+	case reserved:
+		return whoistest.Reserved
+	case registered:
+		return whoistest.Registered
+	}
+	for _, l := range lines {
+		if reFailed.MatchString(strings.TrimSpace(l.Text)) {
+			return whoistest.Failed
+		}
+	}
+	return whoistest.Unknown
+}
+
+func rdapOutcome(res *whois.Response) whoistest.Outcome {
+	var v struct {
+		ErrorCode       int    `json:"errorCode"`
+		ObjectClassName string `json:"objectClassName"`
+	}
+	if err := json.Unmarshal(res.Body, &v); err != nil {
+		return whoistest.Failed
+	}
+	switch {
+	case v.ErrorCode == 404:
+		return whoistest.NotFound
+	case v.ErrorCode == 429:
+		return whoistest.RateLimited
+	case v.ErrorCode != 0:
+		return whoistest.Failed
+	case v.ObjectClassName == "domain":
+		return whoistest.Registered
+	}
+	return whoistest.Unknown
+}
@@ -0,0 +1,65 @@
+package classify
+
+import (
+	"testing"
+
+	"github.com/domainr/whois"
+	"github.com/domainr/whoistest"
+	"github.com/nbio/st"
+)
+
+func TestOutcome(t *testing.T) {
+	c, err := whoistest.NewCorpus()
+	st.Assert(t, err, nil)
+	for _, tt := range []struct {
+		host, query string
+		want        whoistest.Outcome
+	}{
+		{"whois.verisign-grs.com", "google.com", whoistest.Registered},
+		{"whois.verisign-grs.com", "zx5v7d4v2k50l3pq.com", whoistest.NotFound},
+		{"whois.nic.uk", "google.co.uk", whoistest.Registered},
+		{"whois.kr", "nic.kr", whoistest.Reserved},
+		{"whois.kr", "zx5v7d4v2k50l3pq.kr", whoistest.NotFound},
+		{"whois.nic.fr", "www.fr", whoistest.RateLimited},
+		{"whois.fi", "google.fi", whoistest.Registered},
+		{"whois.jprs.jp", "google.co.jp", whoistest.Registered},
+		{"whois.registro.br", "whois.br", whoistest.Reserved},
+		{"whois.registro.br", "www.br", whoistest.Failed},
+	} {
+		rs := c.Responses(whoistest.Host(tt.host), whoistest.Query(tt.query))
+		st.Assert(t, len(rs), 1)
+		st.Expect(t, Outcome(rs[0]), tt.want)
+	}
+
+	res := whois.NewResponse("example.com", "rdap.example.com")
+	res.MediaType = whoistest.RDAPMediaType
+	res.Body = []byte(`{"errorCode":404,"title":"Not Found"}`)
+	st.Expect(t, Outcome(res), whoistest.NotFound)
+	res.Body = []byte(`{"objectClassName":"domain","ldhName":"example.com"}`)
+	st.Expect(t, Outcome(res), whoistest.Registered)
+	res.Body = nil
+	st.Expect(t, Outcome(res), whoistest.Failed)
+}
+
+// TestOutcomeText checks the outcome of every recorded text response is
+// detected. Responses in other media types, such as the HTML pages some
+// hosts return, are not classified.
+func TestOutcomeText(t *testing.T) {
+	c, err := whoistest.NewCorpus()
+	st.Assert(t, err, nil)
+	for _, e := range c.Entries(whoistest.MediaType("text/plain")) {
+		if Outcome(e.Response) == whoistest.Unknown {
+			t.Errorf("%s: unknown outcome", e.Path)
+		}
+	}
+}
+
+// TestIndexOutcomes checks testdata/responses/index.json is up to date.
+// Run go run cmd/gen/main.go -reindex to rebuild it.
+func TestIndexOutcomes(t *testing.T) {
+	m, err := whoistest.Index()
+	st.Assert(t, err, nil)
+	c, err := whoistest.NewCorpus()
+	st.Assert(t, err, nil)
+	st.Expect(t, m, whoistest.NewManifest(c, Outcome))
+}
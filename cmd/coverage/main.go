@@ -0,0 +1,109 @@
+// This command reports, for every zone in zonedb, which samples the corpus
+// in testdata/responses has, using testdata/responses/index.json.
+// To use: go run cmd/coverage/main.go [-format=table|json]
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"text/tabwriter"
+
+	"github.com/domainr/whois"
+	"github.com/domainr/whoistest"
+	"github.com/zonedb/zonedb"
+)
+
+var format string
+
+func init() {
+	flag.StringVar(&format, "format", "table", "Output format: table or json")
+}
+
+func main() {
+	flag.Parse()
+	if err := main1(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// coverage is the corpus coverage of a zone.
+type coverage struct {
+	Zone       string `json:"zone"`
+	Host       string `json:"host,omitempty"` // Whois host, per whois.Server
+	HostDir    bool   `json:"host_dir"`       // Corpus has a directory for Host
+	Registered bool   `json:"registered"`     // Corpus has a registered sample
+	NotFound   bool   `json:"not_found"`      // Corpus has a not-found sample
+}
+
+func main1() error {
+	switch format {
+	case "table", "json":
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+
+	m, err := whoistest.Index()
+	if err != nil {
+		return err
+	}
+	outcomes := make(map[string]map[whoistest.Outcome]bool)
+	for _, e := range m.Responses {
+		if outcomes[e.Zone] == nil {
+			outcomes[e.Zone] = make(map[whoistest.Outcome]bool)
+		}
+		outcomes[e.Zone][e.Outcome] = true
+	}
+
+	zones := make([]coverage, 0, len(zonedb.Zones))
+	for _, z := range zonedb.Zones {
+		c := coverage{
+			Zone:       z.Domain,
+			Registered: outcomes[z.Domain][whoistest.Registered],
+			NotFound:   outcomes[z.Domain][whoistest.NotFound],
+		}
+		if host, _, err := whois.Server("example." + z.Domain); err == nil {
+			c.Host = host
+			fi, err := fs.Stat(whoistest.FS(), host)
+			c.HostDir = err == nil && fi.IsDir()
+		}
+		zones = append(zones, c)
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		return enc.Encode(struct {
+			Zones []coverage `json:"zones"`
+		}{zones})
+	}
+
+	var registered, notFound int
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ZONE\tHOST\tHOST DIR\tREGISTERED\tNOT FOUND")
+	for _, c := range zones {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", c.Zone, c.Host, yes(c.HostDir), yes(c.Registered), yes(c.NotFound))
+		if c.Registered {
+			registered++
+		}
+		if c.NotFound {
+			notFound++
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("%d zones: %d with a registered sample, %d with a not-found sample\n", len(zones), registered, notFound)
+	return nil
+}
+
+func yes(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "-"
+}
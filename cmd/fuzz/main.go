@@ -0,0 +1,55 @@
+// This command exports the responses in testdata/responses as a seed corpus
+// for a Go fuzz test, in testdata/fuzz/<FuzzName>.
+// To use: go run cmd/fuzz/main.go -name FuzzName [-dir testdata/fuzz] [-host whois.kr,...]
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/domainr/whoistest"
+)
+
+var (
+	name  string
+	dir   string
+	hosts string
+)
+
+func init() {
+	flag.StringVar(&name, "name", "", "Name of the fuzz test, e.g. FuzzParse")
+	flag.StringVar(&dir, "dir", filepath.Join("testdata", "fuzz"), "Directory to write the <FuzzName> corpus directory in")
+	flag.StringVar(&hosts, "host", "", "Comma-separated whois hosts to export (default all)")
+}
+
+func main() {
+	flag.Parse()
+	if err := main1(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func main1() error {
+	if name == "" {
+		return fmt.Errorf("-name is required")
+	}
+	c, err := whoistest.NewCorpus()
+	if err != nil {
+		return err
+	}
+	filters := []whoistest.Filter{whoistest.Whois()}
+	if hosts != "" {
+		filters = append(filters, whoistest.Host(strings.Split(hosts, ",")...))
+	}
+	out := filepath.Join(dir, name)
+	if err := c.WriteFuzzCorpus(out, filters...); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %d seeds to %s\n", len(c.Entries(filters...)), out)
+	return nil
+}
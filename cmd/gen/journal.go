@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// Journal states of a task.
+const (
+	statePending = "pending" // Scheduled, not yet finished
+	stateFetched = "fetched" // Response fetched and written
+	stateFailed  = "failed"  // Fetch or write failed; see Reason
+	stateSkipped = "skipped" // Recorded response younger than -maxage, or no server
+)
+
+// task is a single fetch: the whois or RDAP response for a domain.
+type task struct {
+	Kind   string `json:"kind"` // whois or rdap
+	Domain string `json:"domain"`
+}
+
+// done reports whether state needs no further fetch on -resume.
+func done(state string) bool {
+	return state == stateFetched || state == stateSkipped
+}
+
+// journalRecord is a line of the journal, recording a task's new state.
+type journalRecord struct {
+	Time time.Time `json:"time"`
+	task
+	Host   string `json:"host,omitempty"`
+	State  string `json:"state"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// journal is an append-only JSON Lines file recording the state of each
+// task in a run, so an interrupted run can be resumed. Each record is
+// written with a single write, and a truncated last line is ignored.
+type journal struct {
+	mu   sync.Mutex
+	f    *os.File
+	last map[task]string // State of each task recorded in this run
+}
+
+// openJournal opens the journal at fn. If resume is set, it returns the
+// last recorded state of each task and appends to the journal; otherwise
+// it starts a new, empty journal.
+func openJournal(fn string, resume bool) (*journal, map[task]string, error) {
+	states := make(map[task]string)
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	terminated := true
+	if resume {
+		var err error
+		terminated, err = readJournal(fn, states)
+		if errors.Is(err, fs.ErrNotExist) {
+			fmt.Fprintf(os.Stderr, "No journal at %s; starting a new run\n", fn)
+		} else if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(fn, flags, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !terminated {
+		// End the truncated record, so the next one starts on a new line
+		if _, err := f.Write([]byte{'\n'}); err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+	}
+	return &journal{f: f, last: make(map[task]string)}, states, nil
+}
+
+// readJournal reads the last state of each task in the journal at fn into
+// states, and reports whether the journal ends with a newline.
+func readJournal(fn string, states map[task]string) (bool, error) {
+	fmt.Fprintf(os.Stderr, "Reading %s\n", fn)
+	b, err := os.ReadFile(fn)
+	if err != nil {
+		return true, err
+	}
+	for n, line := range bytes.Split(b, []byte{'\n'}) {
+		if len(line) == 0 {
+			continue
+		}
+		var r journalRecord
+		if err := json.Unmarshal(line, &r); err != nil {
+			// Interrupted mid-write; the task is retried
+			fmt.Fprintf(os.Stderr, "%s:%d: ignoring malformed record: %s\n", fn, n+1, err)
+			continue
+		}
+		states[r.task] = r.State
+	}
+	return len(b) == 0 || b[len(b)-1] == '\n', nil
+}
+
+// record appends the new state of t to the journal.
+func (j *journal) record(t task, host, state, reason string) {
+	b, err := json.Marshal(journalRecord{
+		Time:   time.Now().UTC(),
+		task:   t,
+		Host:   host,
+		State:  state,
+		Reason: reason,
+	})
+	if err != nil {
+		panic(err)
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.last[t] = state
+	if _, err := j.f.Write(append(b, '\n')); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing journal: %s\n", err)
+	}
+}
+
+// counts returns the number of tasks in each state recorded in this run.
+func (j *journal) counts() map[string]int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	c := make(map[string]int)
+	for _, state := range j.last {
+		c[state]++
+	}
+	return c
+}
+
+// Close flushes the journal to disk and closes it.
+func (j *journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.f.Sync(); err != nil {
+		j.f.Close()
+		return err
+	}
+	return j.f.Close()
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nbio/st"
+)
+
+var (
+	taskCom  = task{Kind: "whois", Domain: "example.com"}
+	taskNet  = task{Kind: "whois", Domain: "example.net"}
+	taskOrg  = task{Kind: "whois", Domain: "example.org"}
+	taskRDAP = task{Kind: "rdap", Domain: "example.com"}
+)
+
+func TestJournalResume(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "journal.jsonl")
+	j, states, err := openJournal(fn, false)
+	st.Assert(t, err, nil)
+	st.Expect(t, len(states), 0)
+	j.record(taskCom, "", statePending, "")
+	j.record(taskNet, "", statePending, "")
+	j.record(taskOrg, "", statePending, "")
+	j.record(taskRDAP, "", statePending, "")
+	j.record(taskCom, "whois.verisign-grs.com", stateFetched, "")
+	j.record(taskNet, "whois.verisign-grs.com", stateFailed, "rate limited")
+	j.record(taskRDAP, "", stateSkipped, "no RDAP service")
+	st.Expect(t, j.counts(), map[string]int{stateFetched: 1, stateFailed: 1, statePending: 1, stateSkipped: 1})
+	st.Assert(t, j.Close(), nil)
+
+	// The last recorded state of each task wins
+	j, states, err = openJournal(fn, true)
+	st.Assert(t, err, nil)
+	st.Expect(t, states, map[task]string{
+		taskCom:  stateFetched,
+		taskNet:  stateFailed,
+		taskOrg:  statePending,
+		taskRDAP: stateSkipped,
+	})
+	st.Expect(t, done(states[taskCom]), true)
+	st.Expect(t, done(states[taskRDAP]), true)
+	st.Expect(t, done(states[taskNet]), false)
+	st.Expect(t, done(states[taskOrg]), false)
+	st.Expect(t, done(states[task{Kind: "whois", Domain: "example.io"}]), false)
+
+	// A resumed run appends, and only counts its own records
+	st.Expect(t, len(j.counts()), 0)
+	j.record(taskNet, "whois.verisign-grs.com", stateFetched, "")
+	st.Assert(t, j.Close(), nil)
+
+	states = make(map[task]string)
+	terminated, err := readJournal(fn, states)
+	st.Assert(t, err, nil)
+	st.Expect(t, terminated, true)
+	st.Expect(t, states[taskNet], stateFetched)
+	st.Expect(t, states[taskCom], stateFetched)
+	st.Expect(t, len(states), 4)
+}
+
+func TestJournalTruncated(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "journal.jsonl")
+	st.Assert(t, os.WriteFile(fn, []byte(
+		`{"kind":"whois","domain":"example.com","state":"pending"}`+"\n"+
+			`{"kind":"whois","domain":"example.com","state":"fetched"}`+"\n"+
+			`{"kind":"whois","domain":"example.net","sta`), 0644), nil)
+
+	states := make(map[task]string)
+	terminated, err := readJournal(fn, states)
+	st.Assert(t, err, nil)
+	st.Expect(t, terminated, false)
+	st.Expect(t, states, map[task]string{taskCom: stateFetched})
+
+	// The truncated record is ended before new records are appended
+	j, states, err := openJournal(fn, true)
+	st.Assert(t, err, nil)
+	st.Expect(t, states, map[task]string{taskCom: stateFetched})
+	j.record(taskNet, "whois.verisign-grs.com", stateFetched, "")
+	st.Assert(t, j.Close(), nil)
+
+	states = make(map[task]string)
+	terminated, err = readJournal(fn, states)
+	st.Assert(t, err, nil)
+	st.Expect(t, terminated, true)
+	st.Expect(t, states, map[task]string{taskCom: stateFetched, taskNet: stateFetched})
+}
+
+func TestJournalNew(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "journal.jsonl")
+
+	// Resuming without a journal starts a new run
+	j, states, err := openJournal(fn, true)
+	st.Assert(t, err, nil)
+	st.Expect(t, len(states), 0)
+	j.record(taskCom, "whois.verisign-grs.com", stateFetched, "")
+	st.Assert(t, j.Close(), nil)
+
+	// Not resuming discards the previous run
+	j, states, err = openJournal(fn, false)
+	st.Assert(t, err, nil)
+	st.Expect(t, len(states), 0)
+	st.Assert(t, j.Close(), nil)
+	b, err := os.ReadFile(fn)
+	st.Assert(t, err, nil)
+	st.Expect(t, len(b), 0)
+}
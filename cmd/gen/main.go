@@ -2,28 +2,46 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"encoding/json"
 	"time"
 
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"regexp"
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 
 	"github.com/domainr/whois"
 	"github.com/domainr/whoistest"
+	"github.com/domainr/whoistest/classify"
+	"github.com/domainr/whoistest/redact"
 	"github.com/zonedb/zonedb"
 	"golang.org/x/net/idna"
 )
 
 var (
-	v, quick       bool
+	v, quick, rdap bool
+	redactPII      bool
+	reindex        bool
+	resume         bool
+	plan           bool
 	oneZone        string
 	maxAge         time.Duration
+	timeout        time.Duration
+	requestTimeout time.Duration
 	concurrency    int
+	maxAttempts    int
+	backoff        time.Duration
+	maxBackoff     time.Duration
+	politenessFile string
+	journalFile    string
 	zones          []string
 	prefixes       []string
 	firstLabel     = regexp.MustCompile(`^[^\.]+\.`)
@@ -34,9 +52,21 @@ var (
 func init() {
 	flag.BoolVar(&v, "v", false, "verbose output (to stderr)")
 	flag.BoolVar(&quick, "quick", false, "Only query a shorter subset of zones")
+	flag.BoolVar(&rdap, "rdap", false, "Also fetch RDAP responses")
+	flag.BoolVar(&plan, "plan", false, "Print which responses would be fetched or skipped, without fetching")
+	flag.BoolVar(&reindex, "reindex", false, "Only rebuild testdata/responses/index.json, without fetching")
+	flag.BoolVar(&resume, "resume", false, "Resume the run recorded in the journal, fetching only unfinished and failed domains")
+	flag.StringVar(&journalFile, "journal", filepath.Join(_dir, "journal.jsonl"), "Progress journal file")
+	flag.BoolVar(&redactPII, "redact", false, "Redact personal data before writing responses, printing a JSON record of each redaction to stdout (key from $WHOISTEST_REDACT_KEY)")
 	flag.StringVar(&oneZone, "zone", "", "Only query a specific zone")
 	flag.IntVar(&concurrency, "concurrency", 32, "Set maximum number of concurrent requests")
+	flag.StringVar(&politenessFile, "politeness", filepath.Join(_dir, "politeness.json"), "Per-host query policy file (concurrency, interval, per_minute, per_hour)")
 	flag.DurationVar(&maxAge, "maxage", (24 * time.Hour * 30), "Set max age of responses before re-fetching")
+	flag.DurationVar(&timeout, "timeout", 0, "Maximum duration of the whole run, e.g. 2h (0 for none)")
+	flag.DurationVar(&requestTimeout, "request-timeout", whois.DefaultTimeout, "Maximum duration of each request attempt")
+	flag.IntVar(&maxAttempts, "max-attempts", 4, "Maximum attempts per query, retrying timeouts, resets and rate limits")
+	flag.DurationVar(&backoff, "backoff", 2*time.Second, "Delay before the first retry, doubled for each further retry")
+	flag.DurationVar(&maxBackoff, "max-backoff", time.Minute, "Maximum delay between retries")
 }
 
 func main() {
@@ -49,6 +79,10 @@ func main() {
 }
 
 func main1() error {
+	if reindex {
+		return writeIndex()
+	}
+
 	var zones []string
 	switch {
 	case oneZone != "":
@@ -86,105 +120,348 @@ func main1() error {
 		}
 	}
 
+	if plan {
+		return printPlan(domains)
+	}
+
 	fmt.Fprintf(os.Stderr, "Querying whois for %d domains (%d prefixes × %d zones + extras)\n", len(domains), len(prefixes), len(zones))
 
-	responses := make(chan *whois.Response)
+	// Requests run under ctx, bounded by -timeout. On SIGINT or SIGTERM,
+	// stop is done: no new requests start, and those in flight finish or
+	// time out. A second signal kills the process.
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	stop, stopSignals := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+	exiting := make(chan struct{})
+	defer close(exiting)
+	go func() {
+		select {
+		case <-stop.Done():
+		case <-exiting:
+			return
+		}
+		stopSignals()
+		if ctx.Err() != nil {
+			fmt.Fprintf(os.Stderr, "Timed out after %s; writing fetched responses\n", timeout)
+		} else {
+			fmt.Fprintf(os.Stderr, "Interrupted; finishing requests in flight (interrupt again to quit)\n")
+		}
+	}()
+	client := whois.NewClient(0)
+
+	// Read the RDAP bootstrap before any fetch starts, so failing to
+	// read it leaves no fetches behind.
+	var bootstrap rdapBootstrap
+	if rdap {
+		bctx, cancel := context.WithTimeout(stop, requestTimeout)
+		bootstrap, err = readRDAPBootstrap(bctx)
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+
+	polite, err := readPoliteness(politenessFile)
+	if err != nil {
+		return err
+	}
+	hosts := &hostLimiters{politeness: polite}
+
+	j, states, err := openJournal(journalFile, resume)
+	if err != nil {
+		return err
+	}
+	defer j.Close()
+	if resume {
+		fmt.Fprintf(os.Stderr, "Resuming run with %d journaled domains\n", len(states))
+	}
+
+	// start reports whether a resumed run already finished t, and
+	// otherwise records t as pending.
+	start := func(t task) bool {
+		if done(states[t]) {
+			return true
+		}
+		j.record(t, "", statePending, "")
+		return false
+	}
+
+	responses := make(chan result)
 	var limiter = make(chan struct{}, concurrency)
-	var hostLimiters = make(map[string](chan struct{}))
-	m := &sync.RWMutex{}
+	var finished int32 // Tasks a resumed run already finished
 	for domain, _ := range domains {
 		go func(domain string) {
+			t := task{Kind: "whois", Domain: domain}
+			if start(t) {
+				atomic.AddInt32(&finished, 1)
+				responses <- result{task: t}
+				return
+			}
 			req, err := whois.NewRequest(domain)
 			if err != nil {
+				j.record(t, "", stateSkipped, err.Error())
+				responses <- result{task: t}
 				return
 			}
 
-			// Only re-fetch responses > 1 month old
-			res, err := whois.ReadMIMEFile(whoistest.ResponseFilename(req.Query, req.Host))
-			if err == nil && time.Since(res.FetchedAt) < maxAge {
+			// Only re-fetch responses > 1 month old, unless resuming a task
+			res, fresh := existing(req.Query, req.Host)
+			if _, resumed := states[t]; fresh && !resumed {
 				if v {
 					fmt.Fprintf(os.Stderr, "Skipping %s from %s\n", req.Query, req.Host)
 				}
-				responses <- nil
+				j.record(t, req.Host, stateSkipped, "")
+				responses <- result{task: t}
 				return
 			}
 
-			// Per-host semaphore to limit concurrency
-			m.RLock()
-			hostLimiter, ok := hostLimiters[req.Host]
-			m.RUnlock()
-			if !ok {
-				m.Lock()
-				hostLimiters[req.Host] = make(chan struct{}, 1)
-				hostLimiter = hostLimiters[req.Host]
-				m.Unlock()
+			// Per-host policy to limit concurrency and pace queries. The
+			// global -concurrency slot is held only while a query is in
+			// flight. Once stopped, tasks not yet started stay pending.
+			hl := hosts.get(req.Host)
+			if hl.acquire(stop) != nil {
+				responses <- result{task: t}
+				return
 			}
-			// Acquire
-			hostLimiter <- struct{}{}
-			limiter <- struct{}{}
-			// Release
+			defer hl.release()
 			defer func() {
-				responses <- res
-				<-hostLimiter
-				<-limiter
+				responses <- result{task: t, res: res}
 			}()
 
 			if v {
 				fmt.Fprintf(os.Stderr, "Fetching %s from %s\n", req.Query, req.Host)
 			}
-			res, err = whois.DefaultClient.Fetch(req)
+			res, err = fetchWithRetry(stop, req.Query, req.Host, func() (*whois.Response, error) {
+				return hl.do(stop, limiter, func() (*whois.Response, error) {
+					rctx, cancel := context.WithTimeout(ctx, requestTimeout)
+					defer cancel()
+					return client.FetchContext(rctx, req)
+				})
+			})
 			if err != nil {
+				// A task cut short by stopping stays pending
+				if res == nil && stop.Err() != nil {
+					return
+				}
 				fmt.Fprintf(os.Stderr, "Error fetching whois for %s: %s\n", req.Query, err)
+				// A rate-limited reply is still written, and journaled there
+				if res == nil {
+					j.record(t, req.Host, stateFailed, err.Error())
+				}
 				return
 			}
 		}(domain)
 	}
 
+	n := len(domains)
+	if rdap {
+		n += len(domains)
+		for domain, _ := range domains {
+			go func(domain string) {
+				t := task{Kind: "rdap", Domain: domain}
+				if start(t) {
+					atomic.AddInt32(&finished, 1)
+					responses <- result{task: t}
+					return
+				}
+				u := bootstrap.URL(domain)
+				if u == "" {
+					j.record(t, "", stateSkipped, "no RDAP service")
+					responses <- result{task: t}
+					return
+				}
+
+				res, fresh := existing(domain, rdapHost(u))
+				if _, resumed := states[t]; fresh && !resumed {
+					if v {
+						fmt.Fprintf(os.Stderr, "Skipping RDAP %s from %s\n", domain, res.Host)
+					}
+					j.record(t, res.Host, stateSkipped, "")
+					responses <- result{task: t}
+					return
+				}
+
+				hl := hosts.get(rdapHost(u))
+				if hl.acquire(stop) != nil {
+					responses <- result{task: t}
+					return
+				}
+				defer hl.release()
+				defer func() {
+					responses <- result{task: t, res: res}
+				}()
+
+				if v {
+					fmt.Fprintf(os.Stderr, "Fetching RDAP %s from %s\n", domain, u)
+				}
+				var err error
+				res, err = fetchWithRetry(stop, domain, rdapHost(u), func() (*whois.Response, error) {
+					return hl.do(stop, limiter, func() (*whois.Response, error) {
+						rctx, cancel := context.WithTimeout(ctx, requestTimeout)
+						defer cancel()
+						return fetchRDAP(rctx, domain, u)
+					})
+				})
+				if err != nil {
+					// A task cut short by stopping stays pending
+					if res == nil && stop.Err() != nil {
+						return
+					}
+					fmt.Fprintf(os.Stderr, "Error fetching RDAP for %s: %s\n", domain, err)
+					// A rate-limited reply is still written, and journaled there
+					if res == nil {
+						j.record(t, rdapHost(u), stateFailed, err.Error())
+					}
+					return
+				}
+			}(domain)
+		}
+	}
+
+	redactor := &redact.Redactor{Key: []byte(os.Getenv("WHOISTEST_REDACT_KEY"))}
+	redactions := &redactionLog{enc: json.NewEncoder(os.Stdout)}
+	redactions.enc.SetEscapeHTML(false)
+
 	// Collect from goroutines
 	var wg sync.WaitGroup
-	wg.Add(len(domains))
-	for i := 0; i < len(domains); i++ {
+	var failed int32
+	wg.Add(n)
+	for i := 0; i < n; i++ {
 		go func() {
-			res := <-responses
+			r := <-responses
 			defer wg.Done()
 
+			res := r.res
 			if res == nil {
 				return
 			}
 
 			if res.Host == "" {
 				fmt.Fprintf(os.Stderr, "Response for %q had no host\n", res.Query)
+				j.record(r.task, "", stateFailed, "no host")
 				return
 			}
 
 			if len(res.Body) == 0 {
 				fmt.Fprintf(os.Stderr, "Response for %q had empty body\n", res.Query)
+				j.record(r.task, res.Host, stateFailed, "empty body")
 				return
 			}
 
-			fn := whoistest.ResponseFilename(res.Query, res.Host)
+			var rs []redact.Redaction // Redactions in res, recorded once written
+			if redactPII && res.MediaType == "text/plain" {
+				var redacted *whois.Response
+				var err error
+				redacted, rs, err = redactor.Redact(res)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error redacting response for %q: %s\n", res.Query, err)
+					j.record(r.task, res.Host, stateFailed, err.Error())
+					atomic.AddInt32(&failed, 1)
+					return
+				}
+				res = redacted
+				if v && len(rs) > 0 {
+					fmt.Fprintf(os.Stderr, "Redacted %d values from %s\n", len(rs), res.Query)
+				}
+			}
 
-			dir := filepath.Dir(fn)
-			err := os.MkdirAll(dir, os.ModePerm)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error creating response directory for %s: %s\n", res.Host, err)
+			fn := whoistest.ResponseFilename(res.Query, res.Host)
+			if overwritesGood(fn, res) {
+				fmt.Fprintf(os.Stderr, "Keeping existing response for %s from %s instead of a rate-limit reply\n", res.Query, res.Host)
+				j.record(r.task, res.Host, stateFailed, "rate limited")
 				return
 			}
 
-			f, err := os.Create(fn)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error creating response file for %s: %s\n", res.Query, err)
+			if err := whoistest.WriteResponseFile(fn, res); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing response file for %s: %s\n", res.Query, err)
+				j.record(r.task, res.Host, stateFailed, err.Error())
+				atomic.AddInt32(&failed, 1)
 				return
 			}
-			defer f.Close()
-			res.WriteMIME(f)
+			if err := redactions.write(fn, rs); err != nil {
+				fmt.Fprintf(os.Stderr, "Error recording redactions for %s: %s\n", res.Query, err)
+			}
+			if rateLimited(res) {
+				j.record(r.task, res.Host, stateFailed, "rate limited")
+				return
+			}
+			j.record(r.task, res.Host, stateFetched, "")
 		}()
 	}
 	wg.Wait()
 
+	c := j.counts()
+	fmt.Fprintf(os.Stderr, "Fetched %d, skipped %d, failed %d, unfinished %d", c[stateFetched], c[stateSkipped], c[stateFailed], c[statePending])
+	if finished > 0 {
+		fmt.Fprintf(os.Stderr, "; %d already done", finished)
+	}
+	fmt.Fprintln(os.Stderr)
+
+	if err := writeIndex(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d responses could not be written", failed)
+	}
+	if stop.Err() != nil {
+		return fmt.Errorf("stopped with %d domains unfinished; rerun with -resume to continue", c[statePending])
+	}
+	return nil
+}
+
+// result is the outcome of a task: its response, or nil if there is
+// nothing to write.
+type result struct {
+	task
+	res *whois.Response
+}
+
+// redactionLog records each redaction in a written response file as a
+// line of JSON, like cmd/redact.
+type redactionLog struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// redactionRecord is a redaction in a response file.
+type redactionRecord struct {
+	File string `json:"file"`
+	redact.Redaction
+}
+
+func (l *redactionLog) write(fn string, rs []redact.Redaction) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, rd := range rs {
+		if err := l.enc.Encode(redactionRecord{fn, rd}); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// writeIndex rebuilds the manifest of testdata/responses.
+func writeIndex() error {
+	dir := filepath.Join(_dir, "..", "..", "testdata", "responses")
+	fmt.Fprintf(os.Stderr, "Writing %s\n", filepath.Join(dir, whoistest.ManifestFilename))
+	return whoistest.Reindex(dir, classify.Outcome)
+}
+
+// existing returns the recorded response for query from host, if any,
+// and whether it is younger than -maxage, so need not be re-fetched.
+func existing(query, host string) (*whois.Response, bool) {
+	res, err := whois.ReadMIMEFile(whoistest.ResponseFilename(query, host))
+	if err != nil {
+		return nil, false
+	}
+	return res, time.Since(res.FetchedAt) < maxAge
+}
+
 var whitespaceAndComments = regexp.MustCompile(`\s+|#.+$`)
 
 func readLines(fn string) ([]string, error) {
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/domainr/whois"
+)
+
+// Plan actions for a domain.
+const (
+	planNew   = "new"   // No recorded response; would fetch
+	planFetch = "fetch" // Recorded response older than -maxage; would re-fetch
+	planSkip  = "skip"  // Recorded response younger than -maxage
+)
+
+// planItem is the planned action for a domain.
+type planItem struct {
+	domain string
+	action string
+	age    time.Duration // Age of the recorded response, if any
+}
+
+// printPlan prints, per whois host, the action gen would take for each of
+// domains and the age of its recorded response, without fetching.
+func printPlan(domains map[string]bool) error {
+	hosts := make(map[string][]planItem)
+	var noServer []string
+	counts := make(map[string]int)
+	for domain := range domains {
+		req, err := whois.NewRequest(domain)
+		if err != nil {
+			noServer = append(noServer, domain)
+			continue
+		}
+		item := planItem{domain: req.Query, action: planNew}
+		if res, fresh := existing(req.Query, req.Host); res != nil {
+			item.age = time.Since(res.FetchedAt)
+			item.action = planFetch
+			if fresh {
+				item.action = planSkip
+			}
+		}
+		hosts[req.Host] = append(hosts[req.Host], item)
+		counts[item.action]++
+	}
+
+	names := make([]string, 0, len(hosts))
+	for host := range hosts {
+		names = append(names, host)
+	}
+	sort.Strings(names)
+	for _, host := range names {
+		items := hosts[host]
+		sort.Slice(items, func(i, j int) bool { return items[i].domain < items[j].domain })
+		c := make(map[string]int)
+		for _, item := range items {
+			c[item.action]++
+		}
+		fmt.Printf("%s (%d new, %d fetch, %d skip)\n", host, c[planNew], c[planFetch], c[planSkip])
+		for _, item := range items {
+			fmt.Printf("  %-5s  %6s  %s\n", item.action, formatAge(item), item.domain)
+		}
+	}
+	if len(noServer) > 0 {
+		sort.Strings(noServer)
+		fmt.Printf("(no whois server) (%d)\n", len(noServer))
+		for _, domain := range noServer {
+			fmt.Printf("  %-5s  %6s  %s\n", "none", "-", domain)
+		}
+	}
+
+	fmt.Printf("%d domains on %d hosts: %d new, %d fetch, %d skip (-maxage %s)\n",
+		len(domains), len(hosts), counts[planNew], counts[planFetch], counts[planSkip], maxAge)
+	if rdap {
+		fmt.Fprintln(os.Stderr, "RDAP responses are not planned, since their hosts come from the IANA bootstrap registry")
+	}
+	return nil
+}
+
+// formatAge formats the age of a recorded response in hours or days.
+func formatAge(item planItem) string {
+	switch {
+	case item.action == planNew:
+		return "-"
+	case item.age < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(item.age.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(item.age.Hours()/24))
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/domainr/whois"
+)
+
+// politeness is the query policy for whois and RDAP hosts, read from a
+// JSON file such as cmd/gen/politeness.json. Hosts not listed, and fields
+// a host's policy omits, use Default.
+type politeness struct {
+	Version int               `json:"version"`
+	Default policy            `json:"default"`
+	Hosts   map[string]policy `json:"hosts"`
+}
+
+// policy limits the queries sent to a host. Zero fields are unlimited,
+// except Concurrency, which is at least 1.
+type policy struct {
+	Concurrency int      `json:"concurrency,omitempty"` // Maximum queries in flight
+	Interval    duration `json:"interval,omitempty"`    // Minimum time between the starts of queries
+	PerMinute   int      `json:"per_minute,omitempty"`  // Maximum queries per minute
+	PerHour     int      `json:"per_hour,omitempty"`    // Maximum queries per hour
+}
+
+// duration is a time.Duration encoded in JSON as a string such as "2s".
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	*d = duration(v)
+	return err
+}
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func readPoliteness(fn string) (*politeness, error) {
+	fmt.Fprintf(os.Stderr, "Reading %s\n", fn)
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var p politeness
+	if err := json.NewDecoder(f).Decode(&p); err != nil {
+		return nil, fmt.Errorf("%s: %s", fn, err)
+	}
+	if p.Version != 1 {
+		return nil, fmt.Errorf("%s: unsupported version %d", fn, p.Version)
+	}
+	return &p, nil
+}
+
+// policy returns the policy for host, filling fields it omits from Default.
+func (p *politeness) policy(host string) policy {
+	hp, d := p.Hosts[host], p.Default
+	if hp.Concurrency == 0 {
+		hp.Concurrency = d.Concurrency
+	}
+	if hp.Concurrency < 1 {
+		hp.Concurrency = 1
+	}
+	if hp.Interval == 0 {
+		hp.Interval = d.Interval
+	}
+	if hp.PerMinute == 0 {
+		hp.PerMinute = d.PerMinute
+	}
+	if hp.PerHour == 0 {
+		hp.PerHour = d.PerHour
+	}
+	return hp
+}
+
+// hostLimiter enforces a policy for a single host.
+type hostLimiter struct {
+	policy
+	sem chan struct{}
+
+	mu     sync.Mutex
+	starts []time.Time // Scheduled query starts in the last hour
+}
+
+func newHostLimiter(p policy) *hostLimiter {
+	return &hostLimiter{policy: p, sem: make(chan struct{}, p.Concurrency)}
+}
+
+// acquire and release bound the queries in flight to the host.
+func (l *hostLimiter) acquire(ctx context.Context) error { return acquire(ctx, l.sem) }
+func (l *hostLimiter) release()                          { <-l.sem }
+
+// wait blocks until a query may start under the policy's interval and
+// rate limits, and reserves that start. It returns early with ctx's error
+// if ctx is done first.
+func (l *hostLimiter) wait(ctx context.Context) error {
+	return sleep(ctx, l.reserve(time.Now()))
+}
+
+// do calls fetch once its start is due under the policy, holding a slot
+// in the global semaphore sem only while fetch runs, so waiting on one
+// host's schedule does not hold up queries to other hosts.
+func (l *hostLimiter) do(ctx context.Context, sem chan struct{}, fetch func() (*whois.Response, error)) (*whois.Response, error) {
+	if err := l.wait(ctx); err != nil {
+		return nil, err
+	}
+	if err := acquire(ctx, sem); err != nil {
+		return nil, err
+	}
+	defer func() { <-sem }()
+	return fetch()
+}
+
+// reserve schedules the next query start at or after now, and returns
+// how long to wait for it.
+func (l *hostLimiter) reserve(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Forget starts more than an hour old
+	i := 0
+	for i < len(l.starts) && now.Sub(l.starts[i]) >= time.Hour {
+		i++
+	}
+	l.starts = l.starts[i:]
+
+	// Starts are scheduled in order, so starts stays sorted
+	at := now
+	if n := len(l.starts); n > 0 {
+		if t := l.starts[n-1].Add(time.Duration(l.Interval)); t.After(at) {
+			at = t
+		}
+	}
+	at = l.window(at, time.Minute, l.PerMinute)
+	at = l.window(at, time.Hour, l.PerHour)
+	l.starts = append(l.starts, at)
+	return at.Sub(now)
+}
+
+// window returns the earliest time at or after at when fewer than max
+// starts fall in the preceding span. at must not precede any start.
+func (l *hostLimiter) window(at time.Time, span time.Duration, max int) time.Time {
+	if max <= 0 {
+		return at
+	}
+	for {
+		n := 0
+		var oldest time.Time
+		for _, t := range l.starts {
+			if at.Sub(t) < span {
+				if n == 0 {
+					oldest = t
+				}
+				n++
+			}
+		}
+		if n < max {
+			return at
+		}
+		at = oldest.Add(span)
+	}
+}
+
+// hostLimiters holds a hostLimiter per host.
+type hostLimiters struct {
+	politeness *politeness
+	mu         sync.Mutex
+	hosts      map[string]*hostLimiter
+}
+
+// get returns the limiter for host, creating it if needed.
+func (ls *hostLimiters) get(host string) *hostLimiter {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if ls.hosts == nil {
+		ls.hosts = make(map[string]*hostLimiter)
+	}
+	l, ok := ls.hosts[host]
+	if !ok {
+		l = newHostLimiter(ls.politeness.policy(host))
+		ls.hosts[host] = l
+	}
+	return l
+}
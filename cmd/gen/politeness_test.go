@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/domainr/whois"
+	"github.com/nbio/st"
+)
+
+var epoch = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// schedule reserves n starts, each requested at the time the previous
+// one was due, and returns their scheduled times.
+func schedule(l *hostLimiter, n int) []time.Time {
+	now := epoch
+	starts := make([]time.Time, n)
+	for i := range starts {
+		now = now.Add(l.reserve(now))
+		starts[i] = now
+	}
+	return starts
+}
+
+// maxIn returns the most starts that fall within any span.
+func maxIn(starts []time.Time, span time.Duration) int {
+	max := 0
+	for i := range starts {
+		n := 0
+		for _, t := range starts[i:] {
+			if t.Sub(starts[i]) < span {
+				n++
+			}
+		}
+		if n > max {
+			max = n
+		}
+	}
+	return max
+}
+
+func TestReserveInterval(t *testing.T) {
+	l := newHostLimiter(policy{Interval: duration(2 * time.Second)})
+	st.Expect(t, l.reserve(epoch), time.Duration(0))
+	st.Expect(t, l.reserve(epoch), 2*time.Second)
+	st.Expect(t, l.reserve(epoch.Add(time.Second)), 3*time.Second)
+	st.Expect(t, l.reserve(epoch.Add(time.Minute)), time.Duration(0))
+}
+
+func TestReservePerMinute(t *testing.T) {
+	l := newHostLimiter(policy{PerMinute: 3})
+	for i := 0; i < 3; i++ {
+		st.Expect(t, l.reserve(epoch), time.Duration(0))
+	}
+	st.Expect(t, l.reserve(epoch), time.Minute)
+	st.Expect(t, l.reserve(epoch.Add(time.Second)), time.Minute-time.Second)
+
+	starts := schedule(newHostLimiter(policy{PerMinute: 3}), 10)
+	st.Expect(t, maxIn(starts, time.Minute), 3)
+	st.Expect(t, starts[9].Sub(starts[0]), 3*time.Minute)
+}
+
+func TestReservePerHour(t *testing.T) {
+	l := newHostLimiter(policy{PerHour: 2})
+	st.Expect(t, l.reserve(epoch), time.Duration(0))
+	st.Expect(t, l.reserve(epoch.Add(time.Minute)), time.Duration(0))
+	st.Expect(t, l.reserve(epoch.Add(2*time.Minute)), time.Hour-2*time.Minute)
+	st.Expect(t, l.reserve(epoch.Add(time.Hour)), time.Minute)
+
+	// Starts older than an hour are forgotten
+	st.Expect(t, l.reserve(epoch.Add(3*time.Hour)), time.Duration(0))
+	st.Expect(t, len(l.starts), 1)
+}
+
+func TestReserveCombined(t *testing.T) {
+	// The whois.nic.es policy
+	p := policy{Interval: duration(10 * time.Second), PerMinute: 3, PerHour: 30}
+	starts := schedule(newHostLimiter(p), 61)
+	for i := 1; i < len(starts); i++ {
+		st.Expect(t, starts[i].Sub(starts[i-1]) >= 10*time.Second, true)
+	}
+	st.Expect(t, maxIn(starts, time.Minute), 3)
+	st.Expect(t, maxIn(starts, time.Hour), 30)
+	st.Expect(t, starts[30].Sub(starts[0]), time.Hour)
+}
+
+func TestPolicyDefaults(t *testing.T) {
+	p := &politeness{
+		Default: policy{Interval: duration(time.Second), PerMinute: 30},
+		Hosts:   map[string]policy{"whois.nic.es": {Interval: duration(10 * time.Second), PerHour: 30}},
+	}
+	st.Expect(t, p.policy("whois.nic.es"), policy{Concurrency: 1, Interval: duration(10 * time.Second), PerMinute: 30, PerHour: 30})
+	st.Expect(t, p.policy("whois.example"), policy{Concurrency: 1, Interval: duration(time.Second), PerMinute: 30})
+}
+
+func TestHostLimiterDoReleasesWhileWaiting(t *testing.T) {
+	l := newHostLimiter(policy{Interval: duration(100 * time.Millisecond)})
+	l.reserve(time.Now())
+	sem := make(chan struct{}, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.do(context.Background(), sem, func() (*whois.Response, error) { return nil, nil })
+	}()
+
+	// While do waits out the interval, the global slot stays free
+	time.Sleep(20 * time.Millisecond)
+	select {
+	case sem <- struct{}{}:
+		<-sem
+	case <-time.After(50 * time.Millisecond):
+		t.Fatal("global slot held while waiting for the host's schedule")
+	}
+	<-done
+}
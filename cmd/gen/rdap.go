@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/domainr/whois"
+	"github.com/domainr/whoistest"
+)
+
+// rdapBootstrapURL is the IANA RDAP bootstrap registry for domain names (RFC 9224).
+const rdapBootstrapURL = "https://data.iana.org/rdap/dns.json"
+
+// rdapClient fetches RDAP responses. Requests are bounded by their
+// contexts; see -request-timeout.
+var rdapClient = &http.Client{}
+
+// rdapBootstrap maps zones to RDAP base URLs.
+type rdapBootstrap map[string]string
+
+func readRDAPBootstrap(ctx context.Context) (rdapBootstrap, error) {
+	fmt.Fprintf(os.Stderr, "Reading %s\n", rdapBootstrapURL)
+	hreq, err := http.NewRequestWithContext(ctx, "GET", rdapBootstrapURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	hres, err := rdapClient.Do(hreq)
+	if err != nil {
+		return nil, err
+	}
+	defer hres.Body.Close()
+	var reg struct {
+		Services [][][]string `json:"services"`
+	}
+	if err := json.NewDecoder(hres.Body).Decode(&reg); err != nil {
+		return nil, err
+	}
+	b := make(rdapBootstrap)
+	for _, svc := range reg.Services {
+		if len(svc) < 2 || len(svc[1]) == 0 {
+			continue
+		}
+		base := svc[1][0]
+		for _, u := range svc[1] {
+			if strings.HasPrefix(u, "https:") {
+				base = u
+				break
+			}
+		}
+		for _, zone := range svc[0] {
+			b[strings.ToLower(zone)] = base
+		}
+	}
+	return b, nil
+}
+
+// URL returns the RDAP domain lookup URL for domain, or "" if its zone has
+// no RDAP service. The longest matching zone wins.
+func (b rdapBootstrap) URL(domain string) string {
+	for z := domain; z != ""; {
+		if base, ok := b[z]; ok {
+			if !strings.HasSuffix(base, "/") {
+				base += "/"
+			}
+			return base + "domain/" + domain
+		}
+		i := strings.Index(z, ".")
+		if i < 0 {
+			break
+		}
+		z = z[i+1:]
+	}
+	return ""
+}
+
+// fetchRDAP fetches the RDAP response for domain from u.
+// RDAP error objects (e.g. 404 Not Found) are returned as responses.
+func fetchRDAP(ctx context.Context, domain, u string) (*whois.Response, error) {
+	hreq, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	hreq.Header.Set("Accept", whoistest.RDAPMediaType)
+	hres, err := rdapClient.Do(hreq)
+	if err != nil {
+		return nil, err
+	}
+	defer hres.Body.Close()
+	if hres.StatusCode == http.StatusTooManyRequests {
+		return nil, fmt.Errorf("%w: %s", errRateLimited, hres.Status)
+	}
+	res := whois.NewResponse(domain, hreq.URL.Host)
+	res.MediaType = whoistest.RDAPMediaType
+	if res.Body, err = io.ReadAll(io.LimitReader(hres.Body, whois.DefaultReadLimit)); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// rdapHost returns the host of RDAP URL u.
+func rdapHost(u string) string {
+	pu, err := url.Parse(u)
+	if err != nil {
+		return ""
+	}
+	return pu.Host
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/domainr/whois"
+	"github.com/domainr/whoistest"
+	"github.com/domainr/whoistest/classify"
+)
+
+// errRateLimited is returned for replies that refuse a query for exceeding
+// a rate limit, such as HTTP 429 Too Many Requests.
+var errRateLimited = errors.New("rate limited")
+
+// fetchWithRetry calls fetch until it returns a response that is not
+// rate-limited, up to -max-attempts times, backing off exponentially with
+// jitter between attempts. Only temporary errors and rate-limited replies
+// are retried. If every attempt is rate-limited, the last reply is
+// returned along with an error wrapping errRateLimited. Retries stop when
+// ctx is done.
+func fetchWithRetry(ctx context.Context, query, host string, fetch func() (*whois.Response, error)) (*whois.Response, error) {
+	var res *whois.Response
+	var err error
+	for attempt := 1; ; attempt++ {
+		res, err = fetch()
+		switch {
+		case err == nil && rateLimited(res):
+			err = fmt.Errorf("%w by %s", errRateLimited, host)
+		case err == nil:
+			return res, nil
+		case !retryable(err):
+			return nil, err
+		}
+		if attempt >= maxAttempts || ctx.Err() != nil {
+			return res, err
+		}
+		d := backoffDelay(attempt)
+		if v {
+			fmt.Fprintf(os.Stderr, "Retrying %s from %s in %s (attempt %d/%d): %s\n", query, host, d.Round(time.Millisecond), attempt+1, maxAttempts, err)
+		}
+		if sleep(ctx, d) != nil {
+			return res, err
+		}
+	}
+}
+
+// sleep pauses for d, or until ctx is done, returning ctx's error.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// acquire takes a slot in semaphore sem, or returns ctx's error if ctx is
+// done first.
+func acquire(ctx context.Context, sem chan struct{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// backoffDelay returns the delay before the retry following attempt:
+// -backoff doubled for each previous attempt, capped at -max-backoff,
+// with full jitter over its upper half.
+func backoffDelay(attempt int) time.Duration {
+	d := backoff << uint(attempt-1)
+	if d > maxBackoff || d <= 0 {
+		d = maxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryable reports whether err is worth retrying: timeouts, resets and
+// refused or dropped connections, and rate limits.
+// A *whois.FetchError does not unwrap, so its Err is classified instead.
+func retryable(err error) bool {
+	var fe *whois.FetchError
+	if errors.As(err, &fe) {
+		err = fe.Err
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+	for _, target := range []error{
+		errRateLimited,
+		syscall.ECONNRESET,
+		syscall.ECONNREFUSED,
+		syscall.EPIPE,
+		io.EOF,
+		io.ErrUnexpectedEOF,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// rateLimited reports whether res is a reply refusing the query for
+// exceeding a rate limit, either the text its host is known to send
+// (see whoistest.RateLimitText) or one classify detects.
+func rateLimited(res *whois.Response) bool {
+	if text, ok := whoistest.RateLimitText[res.Host]; ok && bytes.Contains(res.Body, []byte(strings.TrimSpace(text))) {
+		return true
+	}
+	return classify.Outcome(res) == whoistest.RateLimited
+}
+
+// overwritesGood reports whether writing res to response file fn would
+// replace a recorded response that is not itself rate-limited.
+func overwritesGood(fn string, res *whois.Response) bool {
+	if !rateLimited(res) {
+		return false
+	}
+	prev, err := whois.ReadMIMEFile(fn)
+	return err == nil && !rateLimited(prev)
+}
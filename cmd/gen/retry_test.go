@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/domainr/whois"
+	"github.com/domainr/whoistest"
+	"github.com/nbio/st"
+)
+
+// withRetries sets the retry flags for the duration of a test.
+func withRetries(t *testing.T, attempts int, d time.Duration) {
+	prevAttempts, prevBackoff, prevMax := maxAttempts, backoff, maxBackoff
+	maxAttempts, backoff, maxBackoff = attempts, d, d
+	t.Cleanup(func() {
+		maxAttempts, backoff, maxBackoff = prevAttempts, prevBackoff, prevMax
+	})
+}
+
+// testRetry fetches query from s with fetchWithRetry, injecting f into
+// the first attempt only, and returns the response, error and the error
+// of each failed attempt.
+func testRetry(t *testing.T, s *whoistest.Server, query string, f whoistest.Fault, timeout time.Duration) (*whois.Response, error, []error) {
+	req := &whois.Request{Query: query, Host: s.Host}
+	st.Assert(t, req.Prepare(), nil)
+	c := s.Client()
+	s.Inject("", "", f)
+	var errs []error
+	res, err := fetchWithRetry(context.Background(), query, s.Host, func() (*whois.Response, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		res, err := c.FetchContext(ctx, req)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		s.ClearFaults()
+		return res, err
+	})
+	return res, err, errs
+}
+
+func TestFetchWithRetryReset(t *testing.T) {
+	withRetries(t, 3, time.Millisecond)
+	s := whoistest.NewServer("whois.kr")
+	defer s.Close()
+
+	res, err, errs := testRetry(t, s, "google.kr", whoistest.Fault{Reset: true}, time.Second)
+	st.Assert(t, err, nil)
+	st.Assert(t, len(errs), 1)
+	_, ok := errs[0].(*whois.FetchError)
+	st.Expect(t, ok, true)
+	st.Expect(t, retryable(errs[0]), true)
+	st.Expect(t, len(res.Body) > 0, true)
+}
+
+func TestFetchWithRetryTimeout(t *testing.T) {
+	withRetries(t, 3, time.Millisecond)
+	s := whoistest.NewServer("whois.kr")
+	defer s.Close()
+
+	res, err, errs := testRetry(t, s, "google.kr", whoistest.Fault{Latency: 500 * time.Millisecond}, 50*time.Millisecond)
+	st.Assert(t, err, nil)
+	st.Assert(t, len(errs), 1)
+	_, ok := errs[0].(*whois.FetchError)
+	st.Expect(t, ok, true)
+	st.Expect(t, retryable(errs[0]), true)
+	st.Expect(t, len(res.Body) > 0, true)
+}
+
+func TestFetchWithRetryGivesUp(t *testing.T) {
+	withRetries(t, 2, time.Millisecond)
+	s := whoistest.NewServer("whois.kr")
+	defer s.Close()
+
+	req := &whois.Request{Query: "google.kr", Host: s.Host}
+	st.Assert(t, req.Prepare(), nil)
+	c := s.Client()
+	s.Inject("", "", whoistest.Fault{Reset: true})
+	attempts := 0
+	res, err := fetchWithRetry(context.Background(), req.Query, s.Host, func() (*whois.Response, error) {
+		attempts++
+		return c.Fetch(req)
+	})
+	st.Expect(t, res == nil, true)
+	st.Refute(t, err, nil)
+	st.Expect(t, attempts, 2)
+}
+
+// rateLimitedServer returns a server for host that replies with its
+// rate-limit text to every query after the first, and that first reply.
+func rateLimitedServer(t *testing.T, host, query string) (*whoistest.Server, *whois.Client, *whois.Request, *whois.Response) {
+	s := whoistest.NewServer(host)
+	t.Cleanup(s.Close)
+	req := &whois.Request{Query: query, Host: s.Host}
+	st.Assert(t, req.Prepare(), nil)
+	c := s.Client()
+	s.Inject("", "", whoistest.Fault{Limit: 1})
+	good, err := c.Fetch(req)
+	st.Assert(t, err, nil)
+	st.Assert(t, rateLimited(good), false)
+	return s, c, req, good
+}
+
+func TestFetchWithRetryRateLimited(t *testing.T) {
+	withRetries(t, 3, time.Millisecond)
+	s, c, req, good := rateLimitedServer(t, "whois.denic.de", "google.de")
+
+	var limited []bool
+	res, err := fetchWithRetry(context.Background(), req.Query, s.Host, func() (*whois.Response, error) {
+		res, err := c.Fetch(req)
+		if err == nil {
+			limited = append(limited, rateLimited(res))
+		}
+		s.ClearFaults()
+		return res, err
+	})
+	st.Assert(t, err, nil)
+	st.Expect(t, limited, []bool{true, false})
+	st.Expect(t, string(res.Body), string(good.Body))
+}
+
+func TestFetchWithRetryRateLimitedGivesUp(t *testing.T) {
+	withRetries(t, 2, time.Millisecond)
+	s, c, req, _ := rateLimitedServer(t, "whois.denic.de", "google.de")
+
+	attempts := 0
+	res, err := fetchWithRetry(context.Background(), req.Query, s.Host, func() (*whois.Response, error) {
+		attempts++
+		return c.Fetch(req)
+	})
+	st.Expect(t, errors.Is(err, errRateLimited), true)
+	st.Expect(t, attempts, 2)
+	st.Assert(t, res != nil, true)
+	st.Expect(t, rateLimited(res), true)
+}
+
+func TestOverwritesGood(t *testing.T) {
+	_, c, req, good := rateLimitedServer(t, "whois.denic.de", "google.de")
+	limited, err := c.Fetch(req)
+	st.Assert(t, err, nil)
+	st.Assert(t, rateLimited(limited), true)
+
+	fn := filepath.Join(t.TempDir(), filepath.FromSlash(whoistest.ResponsePath(req.Query, limited.Host)))
+	st.Expect(t, overwritesGood(fn, limited), false) // No recorded response
+
+	st.Assert(t, whoistest.WriteResponseFile(fn, good), nil)
+	st.Expect(t, overwritesGood(fn, limited), true)
+	st.Expect(t, overwritesGood(fn, good), false)
+
+	st.Assert(t, whoistest.WriteResponseFile(fn, limited), nil)
+	st.Expect(t, overwritesGood(fn, limited), false) // Recorded response is rate-limited too
+}
+
+func TestRetryable(t *testing.T) {
+	st.Expect(t, retryable(errRateLimited), true)
+	st.Expect(t, retryable(&whois.FetchError{Err: context.Canceled, Host: "whois.kr"}), false)
+}
@@ -0,0 +1,87 @@
+// This command replaces personal data in the responses in testdata/responses
+// with stable pseudonyms, rewriting the files in place, and prints a JSON
+// record of each redaction to stdout. The manifest, index.json, is rebuilt
+// after the files are rewritten.
+// To use: WHOISTEST_REDACT_KEY=secret go run cmd/redact/main.go [-dir path/to/responses] [-n]
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/domainr/whoistest"
+	"github.com/domainr/whoistest/classify"
+	"github.com/domainr/whoistest/redact"
+)
+
+var (
+	dir            string
+	key            string
+	dryRun         bool
+	_, _file, _, _ = runtime.Caller(0)
+	_dir           = filepath.Dir(_file)
+)
+
+func init() {
+	flag.StringVar(&dir, "dir", filepath.Join(_dir, "..", "..", "testdata", "responses"), "Redact responses in a directory other than testdata/responses")
+	flag.StringVar(&key, "key", os.Getenv("WHOISTEST_REDACT_KEY"), "Secret key for pseudonyms (default $WHOISTEST_REDACT_KEY)")
+	flag.BoolVar(&dryRun, "n", false, "Print redactions without rewriting files")
+}
+
+func main() {
+	flag.Parse()
+	if err := main1(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// record is a redaction in a response file.
+type record struct {
+	File string `json:"file"`
+	redact.Redaction
+}
+
+func main1() error {
+	c, err := whoistest.LoadCorpus(dir)
+	if err != nil {
+		return err
+	}
+	r := &redact.Redactor{Key: []byte(key)}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+
+	var files, n int
+	for _, e := range c.Entries(whoistest.MediaType("text/plain")) {
+		res, rs, err := r.Redact(e.Response)
+		if err != nil {
+			return fmt.Errorf("%s: %s", e.Path, err)
+		}
+		if len(rs) == 0 {
+			continue
+		}
+		for _, rd := range rs {
+			if err := enc.Encode(record{e.Path, rd}); err != nil {
+				return err
+			}
+		}
+		files++
+		n += len(rs)
+		if dryRun {
+			continue
+		}
+		if err := whoistest.WriteResponseFile(e.Path, res); err != nil {
+			return fmt.Errorf("%s: %s", e.Path, err)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d redactions in %d files\n", n, files)
+	if dryRun || files == 0 {
+		return nil
+	}
+	return whoistest.Reindex(dir, classify.Outcome)
+}
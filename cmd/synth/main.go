@@ -0,0 +1,93 @@
+// This command synthesizes whois responses for arbitrary domains from
+// templates learned from the responses in testdata/responses.
+// To use: go run cmd/synth/main.go -host whois.pir.org [-nameservers 13] [-dnssec] example.org ...
+// With -dir, the manifest of dir, index.json, is rebuilt if it has one.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/domainr/whois"
+	"github.com/domainr/whoistest"
+	"github.com/domainr/whoistest/classify"
+	"github.com/domainr/whoistest/synth"
+)
+
+var (
+	host     string
+	dir      string
+	notFound bool
+	status   string
+	v        synth.Variation
+)
+
+func init() {
+	flag.StringVar(&host, "host", "", "Whois host whose responses to imitate")
+	flag.StringVar(&dir, "dir", "", "Write <host>/<query>.mime files under dir instead of printing to stdout")
+	flag.BoolVar(&notFound, "not-found", false, "Synthesize responses for unregistered domains")
+	flag.IntVar(&v.Nameservers, "nameservers", 0, "Number of nameservers (default as recorded)")
+	flag.IntVar(&v.StreetLines, "street", 0, "Number of street lines per contact (default as recorded)")
+	flag.StringVar(&status, "status", "", "Comma-separated domain statuses (default as recorded)")
+	flag.BoolVar(&v.DNSSEC, "dnssec", false, "Sign the domain and add DS records")
+}
+
+func main() {
+	flag.Parse()
+	if err := main1(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func main1() error {
+	if host == "" || flag.NArg() == 0 {
+		return fmt.Errorf("usage: synth -host host [flags] query ...")
+	}
+	if status != "" {
+		v.Status = strings.Split(status, ",")
+	}
+
+	c, err := whoistest.NewCorpus()
+	if err != nil {
+		return err
+	}
+	t, err := synth.Learn(host, c.Responses(whoistest.Host(host)))
+	if err != nil {
+		return err
+	}
+
+	for _, query := range flag.Args() {
+		var res *whois.Response
+		if notFound {
+			res, err = t.NotFound(query)
+		} else {
+			res, err = t.Synthesize(query, v)
+		}
+		if err != nil {
+			return err
+		}
+		if dir == "" {
+			if err := res.WriteMIME(os.Stdout); err != nil {
+				return err
+			}
+			continue
+		}
+		fn := filepath.Join(dir, res.Host, res.Query+".mime")
+		if err := whoistest.WriteResponseFile(fn, res); err != nil {
+			return err
+		}
+		fmt.Println(fn)
+	}
+	if dir == "" {
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(dir, whoistest.ManifestFilename)); err != nil {
+		return nil
+	}
+	return whoistest.Reindex(dir, classify.Outcome)
+}
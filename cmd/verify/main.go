@@ -0,0 +1,46 @@
+// This command verifies the headers of every response in testdata/responses.
+// To use: go run cmd/verify/main.go [-dir path/to/responses]
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/domainr/whoistest"
+)
+
+var dir string
+
+func init() {
+	flag.StringVar(&dir, "dir", "", "Verify responses in a directory other than testdata/responses")
+}
+
+func main() {
+	flag.Parse()
+	if err := main1(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func main1() error {
+	var ms []*whoistest.Mismatch
+	var err error
+	if dir != "" {
+		ms, err = whoistest.VerifyDir(dir)
+	} else {
+		ms, err = whoistest.Verify()
+	}
+	for _, m := range ms {
+		fmt.Println(m)
+	}
+	if err != nil {
+		return err
+	}
+	if len(ms) > 0 {
+		return fmt.Errorf("%d mismatches found", len(ms))
+	}
+	return nil
+}
@@ -0,0 +1,300 @@
+package whoistest
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/domainr/whois"
+)
+
+// Entry is a single whois response in a Corpus, along with where it
+// was read from.
+type Entry struct {
+	// Name is the slash-separated path of the MIME file relative to the
+	// corpus root, e.g. whois.kr/google.kr.mime.
+	Name string
+
+	// Path is the path of the MIME file on disk, if the corpus is backed
+	// by a directory, or Name otherwise.
+	Path string
+
+	// Layer is the name of the overlay Layer the response came from,
+	// or "" if the corpus is not an overlay.
+	Layer string
+
+	*whois.Response
+
+	src *source
+}
+
+// source is a file system responses are read from.
+type source struct {
+	fsys fs.FS
+	dir  string // Directory backing fsys, if any
+}
+
+// path returns the on-disk path of name, or name if src is not backed
+// by a directory.
+func (src *source) path(name string) string {
+	if src.dir == "" {
+		return name
+	}
+	return filepath.Join(src.dir, filepath.FromSlash(name))
+}
+
+// Corpus is a set of whois responses loaded from a response directory
+// laid out as <host>/<query>.mime.
+type Corpus struct {
+	entries []*Entry
+}
+
+// NewCorpus loads the embedded whois responses in testdata/responses.
+// Returns nil, error if any response fails to load.
+func NewCorpus() (*Corpus, error) {
+	return loadCorpus(&source{FS(), sourceDir()})
+}
+
+// LoadCorpus loads every <host>/<query>.mime response under dir.
+// Returns nil, error if any response fails to load.
+func LoadCorpus(dir string) (*Corpus, error) {
+	return loadCorpus(&source{os.DirFS(dir), dir})
+}
+
+// LoadCorpusFS loads every <host>/<query>.mime response in fsys.
+// Returns nil, error if any response fails to load.
+func LoadCorpusFS(fsys fs.FS) (*Corpus, error) {
+	return loadCorpus(&source{fsys, ""})
+}
+
+func loadCorpus(src *source) (*Corpus, error) {
+	names, err := ResponseFilesFS(src.fsys)
+	if err != nil {
+		return nil, err
+	}
+	c := &Corpus{entries: make([]*Entry, 0, len(names))}
+	for _, name := range names {
+		e, err := src.read(name)
+		if err != nil {
+			return nil, err
+		}
+		c.entries = append(c.entries, e)
+	}
+	return c, nil
+}
+
+func (src *source) read(name string) (*Entry, error) {
+	e := &Entry{Name: name, Path: src.path(name), src: src}
+	f, err := src.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if e.Response, err = whois.ReadMIME(f); err != nil {
+		return nil, fmt.Errorf("%s: %s", e.Path, err)
+	}
+	return e, nil
+}
+
+// Layer is a named Corpus in an overlay.
+type Layer struct {
+	Name   string
+	Corpus *Corpus
+}
+
+// Overlay returns a Corpus combining the responses of layers. When more
+// than one layer holds a response for the same host and query, the one
+// from the last such layer wins, so later layers override earlier ones.
+// Each Entry in the result records the name of the Layer it came from.
+func Overlay(layers ...Layer) *Corpus {
+	byName := make(map[string]*Entry)
+	for _, l := range layers {
+		for _, e := range l.Corpus.entries {
+			le := *e
+			le.Layer = l.Name
+			byName[e.Name] = &le
+		}
+	}
+	c := &Corpus{entries: make([]*Entry, 0, len(byName))}
+	for _, e := range byName {
+		c.entries = append(c.entries, e)
+	}
+	sort.Slice(c.entries, func(i, j int) bool {
+		return c.entries[i].Name < c.entries[j].Name
+	})
+	return c
+}
+
+// PublicLayer is the name of the embedded public corpus in NewOverlay.
+const PublicLayer = "whoistest"
+
+// NewOverlay loads the embedded public corpus overlaid with the responses
+// in each of dirs, in increasing order of precedence. Each directory's
+// Layer is named after the directory; the public layer is PublicLayer.
+// Returns nil, error if any response fails to load.
+func NewOverlay(dirs ...string) (*Corpus, error) {
+	c, err := NewCorpus()
+	if err != nil {
+		return nil, err
+	}
+	layers := []Layer{{PublicLayer, c}}
+	for _, dir := range dirs {
+		c, err := LoadCorpus(dir)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, Layer{dir, c})
+	}
+	return Overlay(layers...), nil
+}
+
+// Len returns the number of responses in the corpus.
+func (c *Corpus) Len() int {
+	return len(c.entries)
+}
+
+// Hosts returns the sorted, unique whois hosts in the corpus.
+func (c *Corpus) Hosts() []string {
+	seen := make(map[string]bool)
+	var hosts []string
+	for _, e := range c.entries {
+		if !seen[e.Host] {
+			seen[e.Host] = true
+			hosts = append(hosts, e.Host)
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// Entries returns the corpus entries matching all of filters, in name order.
+func (c *Corpus) Entries(filters ...Filter) []*Entry {
+	var out []*Entry
+	for _, e := range c.entries {
+		if match(e, filters) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// Responses returns the responses matching all of filters, in name order.
+func (c *Corpus) Responses(filters ...Filter) []*whois.Response {
+	var out []*whois.Response
+	for _, e := range c.entries {
+		if match(e, filters) {
+			out = append(out, e.Response)
+		}
+	}
+	return out
+}
+
+// Each calls fn for each entry matching all of filters, stopping at
+// the first error fn returns.
+func (c *Corpus) Each(fn func(*Entry) error, filters ...Filter) error {
+	for _, e := range c.entries {
+		if !match(e, filters) {
+			continue
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Filter returns a new Corpus holding only the entries matching all of filters.
+func (c *Corpus) Filter(filters ...Filter) *Corpus {
+	return &Corpus{entries: c.Entries(filters...)}
+}
+
+func match(e *Entry, filters []Filter) bool {
+	for _, f := range filters {
+		if !f(e) {
+			return false
+		}
+	}
+	return true
+}
+
+// Filter reports whether a corpus entry should be included.
+type Filter func(*Entry) bool
+
+// Host matches responses fetched from any of hosts.
+func Host(hosts ...string) Filter {
+	set := lowerSet(hosts)
+	return func(e *Entry) bool {
+		return set[strings.ToLower(e.Host)]
+	}
+}
+
+// Query matches responses to any of queries.
+func Query(queries ...string) Filter {
+	set := lowerSet(queries)
+	return func(e *Entry) bool {
+		return set[strings.ToLower(e.Query)]
+	}
+}
+
+// Zone matches responses whose query is any of zones, or a name within them.
+// For example, Zone("uk") matches nic.uk and google.co.uk.
+func Zone(zones ...string) Filter {
+	return func(e *Entry) bool {
+		q := strings.ToLower(e.Query)
+		for _, z := range zones {
+			z = strings.ToLower(strings.Trim(z, "."))
+			if q == z || strings.HasSuffix(q, "."+z) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MediaType matches responses with any of the media types, e.g. text/plain.
+func MediaType(types ...string) Filter {
+	set := lowerSet(types)
+	return func(e *Entry) bool {
+		return set[strings.ToLower(e.MediaType)]
+	}
+}
+
+// Whois matches whois responses, excluding the RDAP responses recorded
+// alongside them. The port 43 servers and the parser helpers such as Run,
+// CheckGolden, Benchmark and AddFuzzSeeds apply it implicitly.
+func Whois() Filter {
+	return func(e *Entry) bool {
+		return !strings.EqualFold(e.MediaType, RDAPMediaType)
+	}
+}
+
+// whoisOnly returns filters restricted to whois responses.
+func whoisOnly(filters []Filter) []Filter {
+	return append([]Filter{Whois()}, filters...)
+}
+
+// FetchedBetween matches responses fetched at or after from and before to.
+// A zero from or to leaves that end of the range open.
+func FetchedBetween(from, to time.Time) Filter {
+	return func(e *Entry) bool {
+		if !from.IsZero() && e.FetchedAt.Before(from) {
+			return false
+		}
+		if !to.IsZero() && !e.FetchedAt.Before(to) {
+			return false
+		}
+		return true
+	}
+}
+
+func lowerSet(ss []string) map[string]bool {
+	set := make(map[string]bool, len(ss))
+	for _, s := range ss {
+		set[strings.ToLower(s)] = true
+	}
+	return set
+}
@@ -0,0 +1,129 @@
+package whoistest
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/domainr/whois"
+	"github.com/nbio/st"
+)
+
+func TestNewCorpus(t *testing.T) {
+	c, err := NewCorpus()
+	st.Assert(t, err, nil)
+	fns, err := ResponseFilesFS(FS())
+	st.Assert(t, err, nil)
+	st.Expect(t, c.Len(), len(fns))
+	st.Expect(t, len(c.Entries()), len(fns))
+	st.Expect(t, len(c.Responses()), len(fns))
+}
+
+func TestCorpusFilters(t *testing.T) {
+	c, err := NewCorpus()
+	st.Assert(t, err, nil)
+
+	for _, e := range c.Entries(Host("whois.nic.uk")) {
+		st.Expect(t, e.Host, "whois.nic.uk")
+		st.Expect(t, e.Name, ResponsePath(e.Query, e.Host))
+	}
+
+	res := c.Responses(Query("GOOGLE.COM"))
+	st.Assert(t, len(res), 1)
+	st.Expect(t, res[0].Host, "whois.verisign-grs.com")
+
+	st.Expect(t, len(c.Entries(Zone("uk"))), 4)
+	st.Expect(t, len(c.Entries(Zone(".co.uk"))), 3)
+	st.Expect(t, len(c.Entries(Zone("uk"), Query("nic.uk"))), 1)
+
+	for _, r := range c.Responses(MediaType("text/html")) {
+		st.Expect(t, r.MediaType, "text/html")
+	}
+
+	cutoff := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	old := c.Filter(FetchedBetween(time.Time{}, cutoff))
+	recent := c.Filter(FetchedBetween(cutoff, time.Time{}))
+	st.Expect(t, old.Len()+recent.Len(), c.Len())
+	for _, r := range old.Responses() {
+		st.Expect(t, r.FetchedAt.Before(cutoff), true)
+	}
+}
+
+func TestCorpusEach(t *testing.T) {
+	c, err := NewCorpus()
+	st.Assert(t, err, nil)
+	var n int
+	err = c.Each(func(e *Entry) error {
+		n++
+		return nil
+	}, Host("whois.kr"))
+	st.Expect(t, err, nil)
+	st.Expect(t, n, len(c.Entries(Host("whois.kr"))))
+	st.Expect(t, n > 0, true)
+}
+
+func TestCorpusHosts(t *testing.T) {
+	c, err := NewCorpus()
+	st.Assert(t, err, nil)
+	hosts := c.Hosts()
+	st.Expect(t, sort.StringsAreSorted(hosts), true)
+	st.Expect(t, len(c.Filter(Host(hosts[0])).Hosts()), 1)
+}
+
+func TestLoadCorpusFS(t *testing.T) {
+	res := whois.NewResponse("example.com", "whois.example.com")
+	res.Body = []byte("Domain Name: EXAMPLE.COM\r\n")
+	var buf bytes.Buffer
+	st.Assert(t, res.WriteMIME(&buf), nil)
+	fsys := fstest.MapFS{
+		ResponsePath(res.Query, res.Host): &fstest.MapFile{Data: buf.Bytes()},
+		"README.md":                       &fstest.MapFile{Data: []byte("Not a response")},
+	}
+	c, err := LoadCorpusFS(fsys)
+	st.Assert(t, err, nil)
+	st.Assert(t, c.Len(), 1)
+	e := c.Entries()[0]
+	st.Expect(t, e.Name, "whois.example.com/example.com.mime")
+	st.Expect(t, e.Path, e.Name)
+	st.Expect(t, string(e.Body), string(res.Body))
+}
+
+func TestOverlay(t *testing.T) {
+	pub, err := NewCorpus()
+	st.Assert(t, err, nil)
+
+	override := whois.NewResponse("google.kr", "whois.kr")
+	override.Body = []byte("Overridden\r\n")
+	extra := whois.NewResponse("example.com", "whois.example.com")
+	extra.Body = []byte("Domain Name: EXAMPLE.COM\r\n")
+	dir := writeCorpus(t, override, extra)
+
+	c, err := NewOverlay(dir)
+	st.Assert(t, err, nil)
+	st.Expect(t, c.Len(), pub.Len()+1)
+	names := make([]string, 0, c.Len())
+	for _, e := range c.Entries() {
+		names = append(names, e.Name)
+	}
+	st.Expect(t, sort.StringsAreSorted(names), true)
+
+	e := c.Entries(Host("whois.kr"), Query("google.kr"))
+	st.Assert(t, len(e), 1)
+	st.Expect(t, e[0].Layer, dir)
+	st.Expect(t, string(e[0].Body), "Overridden\r\n")
+
+	e = c.Entries(Host("whois.example.com"))
+	st.Assert(t, len(e), 1)
+	st.Expect(t, e[0].Layer, dir)
+
+	e = c.Entries(Host("whois.kr"), Query("nic.kr"))
+	st.Assert(t, len(e), 1)
+	st.Expect(t, e[0].Layer, PublicLayer)
+
+	// Layering does not modify the source corpora
+	for _, e := range pub.Entries() {
+		st.Expect(t, e.Layer, "")
+	}
+}
@@ -0,0 +1,162 @@
+package whoistest
+
+import (
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// Fault describes failures and delays a Server injects into its replies.
+// Faults are deterministic for a given Seed.
+type Fault struct {
+	// Latency delays the reply by a fixed duration.
+	Latency time.Duration
+
+	// Jitter adds a random delay in [0, Jitter) on top of Latency.
+	Jitter time.Duration
+
+	// Reset aborts the connection with a TCP reset instead of replying.
+	Reset bool
+
+	// Truncate, if > 0, closes the connection after writing at most
+	// Truncate bytes of the reply.
+	Truncate int
+
+	// Trickle, if > 0, writes the reply one byte at a time,
+	// pausing for Trickle between bytes.
+	Trickle time.Duration
+
+	// Limit, if > 0, refuses queries beyond Limit within any sliding
+	// Window, replying with the host's RateLimitText instead. A zero
+	// Window never expires, refusing every query beyond the first Limit.
+	Limit  int
+	Window time.Duration
+
+	// Garbage, if > 0, replaces the reply with Garbage random bytes.
+	Garbage int
+
+	// Seed seeds the random source used for Jitter and Garbage.
+	Seed int64
+}
+
+// faultKey identifies the host and query a Fault applies to.
+// An empty host or query matches any.
+type faultKey struct {
+	host, query string
+}
+
+type faultState struct {
+	Fault
+	mu      sync.Mutex
+	rand    *rand.Rand
+	queries []time.Time
+}
+
+// Inject arranges for replies to query from host to be subject to f,
+// replacing any fault previously injected for the same host and query.
+// An empty host applies f to every host; an empty query applies f to
+// every query. The most specific fault wins: host and query, then
+// host, then query, then neither.
+func (s *Server) Inject(host, query string, f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.faults == nil {
+		s.faults = make(map[faultKey]*faultState)
+	}
+	s.faults[faultKey{host, query}] = &faultState{
+		Fault: f,
+		rand:  rand.New(rand.NewSource(f.Seed)),
+	}
+}
+
+// ClearFaults removes all injected faults and resets rate-limit counters.
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// fault returns the fault state for query from host, or nil.
+func (s *Server) fault(host, query string) *faultState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, k := range []faultKey{{host, query}, {host, ""}, {"", query}, {"", ""}} {
+		if fs, ok := s.faults[k]; ok {
+			return fs
+		}
+	}
+	return nil
+}
+
+// limited records a query at now and reports whether it exceeds the limit.
+func (fs *faultState) limited(now time.Time) bool {
+	if fs.Limit <= 0 {
+		return false
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	i := 0
+	for fs.Window > 0 && i < len(fs.queries) && now.Sub(fs.queries[i]) >= fs.Window {
+		i++
+	}
+	fs.queries = append(fs.queries[i:], now)
+	return len(fs.queries) > fs.Limit
+}
+
+// delay returns the latency plus a random jitter.
+func (fs *faultState) delay() time.Duration {
+	d := fs.Latency
+	if fs.Jitter > 0 {
+		fs.mu.Lock()
+		d += time.Duration(fs.rand.Int63n(int64(fs.Jitter)))
+		fs.mu.Unlock()
+	}
+	return d
+}
+
+// garbage returns n random bytes.
+func (fs *faultState) garbage(n int) []byte {
+	b := make([]byte, n)
+	fs.mu.Lock()
+	fs.rand.Read(b)
+	fs.mu.Unlock()
+	return b
+}
+
+// reply writes body to conn subject to fs, which may be nil.
+func (fs *faultState) reply(conn net.Conn, host string, body []byte) {
+	if fs == nil {
+		conn.Write(body)
+		return
+	}
+	if fs.Reset {
+		if tc, ok := conn.(*net.TCPConn); ok {
+			tc.SetLinger(0)
+		}
+		return
+	}
+	limited := fs.limited(time.Now())
+	time.Sleep(fs.delay())
+	switch {
+	case limited:
+		body = []byte(rateLimitText(host))
+	case fs.Garbage > 0:
+		body = fs.garbage(fs.Garbage)
+	}
+	if fs.Truncate > 0 && fs.Truncate < len(body) {
+		body = body[:fs.Truncate]
+	}
+	if fs.Trickle <= 0 {
+		conn.Write(body)
+		return
+	}
+	for i := range body {
+		if i > 0 {
+			time.Sleep(fs.Trickle)
+		}
+		if _, err := conn.Write(body[i : i+1]); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package whoistest
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nbio/st"
+)
+
+func TestFaultLatency(t *testing.T) {
+	s := NewServer("whois.kr")
+	defer s.Close()
+	s.Inject("", "google.kr", Fault{Latency: 50 * time.Millisecond, Jitter: 10 * time.Millisecond})
+	start := time.Now()
+	res, err := fetch(t, s, "google.kr", s.Host)
+	st.Assert(t, err, nil)
+	st.Expect(t, time.Since(start) >= 50*time.Millisecond, true)
+	st.Expect(t, len(res.Body) > 0, true)
+}
+
+func TestFaultTruncateAndTrickle(t *testing.T) {
+	s := NewServer("whois.kr")
+	defer s.Close()
+	s.Inject(s.Host, "", Fault{Truncate: 16, Trickle: time.Millisecond})
+	res, err := fetch(t, s, "google.kr", s.Host)
+	st.Assert(t, err, nil)
+	expected, err := readResponse("google.kr", s.Host)
+	st.Assert(t, err, nil)
+	st.Expect(t, string(res.Body), string(expected.Body[:16]))
+}
+
+func TestFaultReset(t *testing.T) {
+	s := NewServer("whois.kr")
+	defer s.Close()
+	s.Inject("", "", Fault{Reset: true})
+	res, err := fetch(t, s, "google.kr", s.Host)
+	st.Refute(t, err, nil)
+	st.Expect(t, res == nil, true)
+}
+
+func TestFaultLimit(t *testing.T) {
+	s := NewServer("whois.denic.de")
+	defer s.Close()
+	s.Inject(s.Host, "", Fault{Limit: 2, Window: time.Hour})
+	for i := 0; i < 2; i++ {
+		res, err := fetch(t, s, "google.de", s.Host)
+		st.Assert(t, err, nil)
+		st.Refute(t, string(res.Body), RateLimitText[s.Host])
+	}
+	res, err := fetch(t, s, "google.de", s.Host)
+	st.Assert(t, err, nil)
+	st.Expect(t, string(res.Body), RateLimitText[s.Host])
+
+	s.ClearFaults()
+	res, err = fetch(t, s, "google.de", s.Host)
+	st.Assert(t, err, nil)
+	st.Refute(t, string(res.Body), RateLimitText[s.Host])
+}
+
+func TestFaultGarbage(t *testing.T) {
+	s := NewServer("whois.kr")
+	defer s.Close()
+	s.Inject("", "", Fault{Garbage: 64, Seed: 1})
+	res1, err := fetch(t, s, "google.kr", s.Host)
+	st.Assert(t, err, nil)
+	st.Expect(t, len(res1.Body), 64)
+
+	// A more specific fault takes precedence; reseeding repeats the bytes
+	s.Inject(s.Host, "google.kr", Fault{Garbage: 64, Seed: 1})
+	res2, err := fetch(t, s, "google.kr", s.Host)
+	st.Assert(t, err, nil)
+	st.Expect(t, bytes.Equal(res1.Body, res2.Body), true)
+}
+
+func TestFaultLimitNoWindow(t *testing.T) {
+	s := NewServer("whois.denic.de")
+	defer s.Close()
+	s.Inject(s.Host, "", Fault{Limit: 1})
+	res, err := fetch(t, s, "google.de", s.Host)
+	st.Assert(t, err, nil)
+	st.Refute(t, string(res.Body), RateLimitText[s.Host])
+	for i := 0; i < 2; i++ {
+		res, err = fetch(t, s, "google.de", s.Host)
+		st.Assert(t, err, nil)
+		st.Expect(t, string(res.Body), RateLimitText[s.Host])
+	}
+}
+
+func TestRateLimitTextRecorded(t *testing.T) {
+	c, err := NewCorpus()
+	st.Assert(t, err, nil)
+	for _, host := range []string{"whois.nic.es", "whois.nic.fr"} {
+		text := []byte(strings.TrimSpace(RateLimitText[host]))
+		var found bool
+		for _, res := range c.Responses(Host(host)) {
+			found = found || bytes.Contains(res.Body, text)
+		}
+		if !found {
+			t.Errorf("%s: RateLimitText not found in recorded responses", host)
+		}
+	}
+}
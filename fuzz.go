@@ -0,0 +1,56 @@
+package whoistest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// AddFuzzSeeds adds the body of each response in the embedded corpus
+// matching filters to the seed corpus of f. See (*Corpus).AddFuzzSeeds.
+func AddFuzzSeeds(f *testing.F, filters ...Filter) {
+	f.Helper()
+	c, err := NewCorpus()
+	if err != nil {
+		f.Fatal(err)
+	}
+	c.AddFuzzSeeds(f, filters...)
+}
+
+// AddFuzzSeeds adds the body of each whois response in c matching filters to
+// the seed corpus of f. The fuzz target takes a single []byte argument:
+//
+//	func FuzzParse(f *testing.F) {
+//		whoistest.AddFuzzSeeds(f, whoistest.Host("whois.kr"))
+//		f.Fuzz(func(t *testing.T, body []byte) {
+//			// ...
+//		})
+//	}
+func (c *Corpus) AddFuzzSeeds(f *testing.F, filters ...Filter) {
+	for _, e := range c.Entries(whoisOnly(filters)...) {
+		f.Add(e.Body)
+	}
+}
+
+// WriteFuzzCorpus writes the body of each whois response in c matching filters
+// to dir, one file per response named <host>_<query>, in the encoding go
+// test uses for the files in testdata/fuzz/<FuzzName>. dir is created if
+// it does not exist. The fuzz target takes a single []byte argument.
+func (c *Corpus) WriteFuzzCorpus(dir string, filters ...Filter) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, e := range c.Entries(whoisOnly(filters)...) {
+		fn := filepath.Join(dir, e.Host+"_"+e.Query)
+		if err := os.WriteFile(fn, marshalFuzzSeed(e.Body), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// marshalFuzzSeed encodes body as a go test fuzz v1 corpus file.
+func marshalFuzzSeed(body []byte) []byte {
+	return []byte(fmt.Sprintf("go test fuzz v1\n[]byte(%q)\n", body))
+}
@@ -0,0 +1,35 @@
+package whoistest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nbio/st"
+)
+
+func TestWriteFuzzCorpus(t *testing.T) {
+	c, err := NewCorpus()
+	st.Assert(t, err, nil)
+	dir := filepath.Join(t.TempDir(), "FuzzParse")
+	st.Assert(t, c.WriteFuzzCorpus(dir, Host("whois.kr")), nil)
+
+	fns, err := filepath.Glob(filepath.Join(dir, "*"))
+	st.Assert(t, err, nil)
+	st.Expect(t, len(fns), len(c.Entries(Host("whois.kr"))))
+
+	b, err := os.ReadFile(filepath.Join(dir, "whois.kr_google.kr"))
+	st.Assert(t, err, nil)
+	res := c.Entries(Host("whois.kr"), Query("google.kr"))[0]
+	st.Expect(t, string(b), string(marshalFuzzSeed(res.Body)))
+}
+
+func TestMarshalFuzzSeed(t *testing.T) {
+	st.Expect(t, string(marshalFuzzSeed([]byte("a: \"b\"\r\n\xff"))),
+		"go test fuzz v1\n[]byte(\"a: \\\"b\\\"\\r\\n\\xff\")\n")
+}
+
+func FuzzCorpus(f *testing.F) {
+	AddFuzzSeeds(f, Host("whois.kr"))
+	f.Fuzz(func(t *testing.T, body []byte) {})
+}
@@ -0,0 +1,220 @@
+package whoistest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/domainr/whois"
+)
+
+// Result is the expected structured parse of a whois response, stored as
+// <query>.golden.json alongside its <query>.mime response file.
+type Result struct {
+	Domain      string             `json:"domain,omitempty"`
+	Available   bool               `json:"available"`
+	Status      []string           `json:"status,omitempty"`
+	Registrar   string             `json:"registrar,omitempty"`
+	Dates       Dates              `json:"dates"`
+	Nameservers []string           `json:"nameservers,omitempty"`
+	Contacts    map[string]Contact `json:"contacts,omitempty"` // keyed by role, e.g. registrant, admin, tech, billing
+}
+
+// Dates holds the lifecycle dates of a registration.
+type Dates struct {
+	Created *time.Time `json:"created,omitempty"`
+	Updated *time.Time `json:"updated,omitempty"`
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// Contact is a registrant, administrative, technical or billing contact.
+type Contact struct {
+	ID           string   `json:"id,omitempty"`
+	Name         string   `json:"name,omitempty"`
+	Organization string   `json:"organization,omitempty"`
+	Street       []string `json:"street,omitempty"`
+	City         string   `json:"city,omitempty"`
+	State        string   `json:"state,omitempty"`
+	PostalCode   string   `json:"postal_code,omitempty"`
+	Country      string   `json:"country,omitempty"`
+	Email        string   `json:"email,omitempty"`
+	Phone        string   `json:"phone,omitempty"`
+	Fax          string   `json:"fax,omitempty"`
+}
+
+// ParseFunc parses a whois response into a Result.
+type ParseFunc func(*whois.Response) (*Result, error)
+
+// UpdateEnv names the environment variable that, when set to a true value
+// such as 1, makes CheckGolden rewrite golden files instead of comparing
+// against them, e.g. WHOISTEST_UPDATE=1 go test ./...
+const UpdateEnv = "WHOISTEST_UPDATE"
+
+// updating reports whether golden files are to be rewritten: if the test
+// binary defines a true -update flag, or $WHOISTEST_UPDATE is true.
+// whoistest does not define -update itself, so it cannot conflict with a
+// test package that does.
+func updating() bool {
+	if f := flag.Lookup("update"); f != nil {
+		if g, ok := f.Value.(flag.Getter); ok {
+			if b, ok := g.Get().(bool); ok && b {
+				return true
+			}
+		}
+	}
+	b, _ := strconv.ParseBool(os.Getenv(UpdateEnv))
+	return b
+}
+
+// GoldenFilename returns the golden file path for a response file path.
+// It works with both slash-separated and OS-specific paths.
+func GoldenFilename(fn string) string {
+	return strings.TrimSuffix(fn, filepath.Ext(fn)) + ".golden.json"
+}
+
+// ReadGolden reads a golden file.
+func ReadGolden(fn string) (*Result, error) {
+	b, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalGolden(fn, b)
+}
+
+// ReadGoldenFS reads the golden file name from fsys.
+func ReadGoldenFS(fsys fs.FS, name string) (*Result, error) {
+	b, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalGolden(name, b)
+}
+
+func unmarshalGolden(fn string, b []byte) (*Result, error) {
+	var r Result
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, fmt.Errorf("%s: %s", fn, err)
+	}
+	return &r, nil
+}
+
+// WriteGolden writes r to a golden file.
+func WriteGolden(fn string, r *Result) error {
+	b, err := marshalGolden(r)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fn, b, 0644)
+}
+
+func marshalGolden(r *Result) ([]byte, error) {
+	b, err := json.MarshalIndent(r, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// CheckGolden runs parse over each response in the corpus matching filters
+// and compares the result against its golden file, in a subtest named
+// <host>/<query>. Responses without a golden file are skipped.
+// With $WHOISTEST_UPDATE or an -update flag defined by the test package set,
+// golden files are (re)written from the parse results instead.
+func CheckGolden(t *testing.T, parse ParseFunc, filters ...Filter) {
+	c, err := NewCorpus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.CheckGolden(t, parse, filters...)
+}
+
+// CheckGolden runs parse over each whois response in c matching filters and
+// compares the result against its golden file. See CheckGolden.
+// Updating golden files requires the responses to be backed by a directory.
+func (c *Corpus) CheckGolden(t *testing.T, parse ParseFunc, filters ...Filter) {
+	for _, e := range c.Entries(whoisOnly(filters)...) {
+		e := e
+		t.Run(e.Host+"/"+e.Query, func(t *testing.T) {
+			name := GoldenFilename(e.Name)
+			want, err := ReadGoldenFS(e.src.fsys, name)
+			if errors.Is(err, fs.ErrNotExist) && !updating() {
+				t.Skipf("no golden file %s", e.src.path(name))
+			}
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				t.Fatal(err)
+			}
+			got, err := parse(e.Response)
+			if err != nil {
+				t.Fatalf("%s: %s", e.Path, err)
+			}
+			if updating() {
+				if e.src.dir == "" {
+					t.Fatalf("cannot update %s: corpus is not backed by a directory", name)
+				}
+				if err := WriteGolden(e.src.path(name), got); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if d := diffGolden(want, got); d != "" {
+				t.Errorf("%s: parse result differs from %s (-want +got):\n%s", e.Path, e.src.path(name), d)
+			}
+		})
+	}
+}
+
+// diffGolden returns a line diff of the JSON encodings of want and got,
+// or "" if they are equal.
+func diffGolden(want, got *Result) string {
+	wb, _ := marshalGolden(want)
+	gb, _ := marshalGolden(got)
+	if bytes.Equal(wb, gb) {
+		return ""
+	}
+	return diffLines(strings.Split(string(wb), "\n"), strings.Split(string(gb), "\n"))
+}
+
+// diffLines returns a minimal line diff of a and b, based on their
+// longest common subsequence.
+func diffLines(a, b []string) string {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var buf bytes.Buffer
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			fmt.Fprintf(&buf, "+%s\n", b[j])
+			j++
+		default:
+			fmt.Fprintf(&buf, "-%s\n", a[i])
+			i++
+		}
+	}
+	return buf.String()
+}
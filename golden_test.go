@@ -0,0 +1,140 @@
+package whoistest
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/domainr/whois"
+	"github.com/nbio/st"
+)
+
+func TestGoldenFilename(t *testing.T) {
+	fn := ResponseFilename("google.com", "whois.verisign-grs.com")
+	st.Expect(t, GoldenFilename(fn), strings.TrimSuffix(fn, ".mime")+".golden.json")
+}
+
+func TestCheckGolden(t *testing.T) {
+	res := whois.NewResponse("example.com", "whois.example.com")
+	res.Body = []byte("Domain Name: EXAMPLE.COM\n")
+	dir := writeCorpus(t, res, whois.NewResponse("example.net", "whois.example.com"))
+	c, err := LoadCorpus(dir)
+	st.Assert(t, err, nil)
+
+	parse := func(res *whois.Response) (*Result, error) {
+		return &Result{Domain: res.Query, Nameservers: []string{"ns1." + res.Query}}, nil
+	}
+	e := c.Entries(Query("example.com"))[0]
+	r, err := parse(e.Response)
+	st.Assert(t, err, nil)
+	st.Assert(t, WriteGolden(GoldenFilename(e.Path), r), nil)
+
+	c.CheckGolden(t, parse)
+
+	golden, err := ReadGolden(GoldenFilename(e.Path))
+	st.Assert(t, err, nil)
+	st.Expect(t, golden.Domain, "example.com")
+}
+
+func TestCheckGoldenUpdate(t *testing.T) {
+	dir := writeCorpus(t, whois.NewResponse("example.com", "whois.example.com"))
+	c, err := LoadCorpus(dir)
+	st.Assert(t, err, nil)
+	parse := func(res *whois.Response) (*Result, error) {
+		return &Result{Domain: res.Query}, nil
+	}
+
+	t.Setenv(UpdateEnv, "1")
+	c.CheckGolden(t, parse)
+
+	e := c.Entries()[0]
+	golden, err := ReadGolden(GoldenFilename(e.Path))
+	st.Assert(t, err, nil)
+	st.Expect(t, golden.Domain, "example.com")
+}
+
+// TestCheckGoldenFlag checks a true -update flag defined by the test
+// package rewrites golden files, as $WHOISTEST_UPDATE does.
+func TestCheckGoldenFlag(t *testing.T) {
+	dir := writeCorpus(t, whois.NewResponse("example.com", "whois.example.com"))
+	c, err := LoadCorpus(dir)
+	st.Assert(t, err, nil)
+	parse := func(res *whois.Response) (*Result, error) {
+		return &Result{Domain: res.Query}, nil
+	}
+
+	prev := flag.CommandLine
+	t.Cleanup(func() { flag.CommandLine = prev })
+	flag.CommandLine = flag.NewFlagSet("test", flag.ContinueOnError)
+	update := flag.Bool("update", false, "update golden files")
+	st.Expect(t, updating(), false)
+	*update = true
+	st.Expect(t, updating(), true)
+	c.CheckGolden(t, parse)
+
+	e := c.Entries()[0]
+	golden, err := ReadGolden(GoldenFilename(e.Path))
+	st.Assert(t, err, nil)
+	st.Expect(t, golden.Domain, "example.com")
+}
+
+// parseVerisign is a minimal ParseFunc for the thin registry responses of
+// whois.verisign-grs.com.
+func parseVerisign(res *whois.Response) (*Result, error) {
+	var r Result
+	s := bufio.NewScanner(bytes.NewReader(res.Body))
+	for s.Scan() {
+		k, v, ok := strings.Cut(strings.TrimSpace(s.Text()), ": ")
+		if !ok {
+			continue
+		}
+		v = strings.TrimSpace(v)
+		switch k {
+		case "Domain Name":
+			r.Domain = strings.ToLower(v)
+		case "Registrar":
+			r.Registrar = v
+		case "Domain Status":
+			r.Status = append(r.Status, strings.Fields(v)[0])
+		case "Name Server":
+			r.Nameservers = append(r.Nameservers, strings.ToLower(v))
+		case "Creation Date", "Updated Date", "Registry Expiry Date":
+			d, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil, err
+			}
+			switch k {
+			case "Creation Date":
+				r.Dates.Created = &d
+			case "Updated Date":
+				r.Dates.Updated = &d
+			default:
+				r.Dates.Expires = &d
+			}
+		}
+	}
+	return &r, s.Err()
+}
+
+// TestCheckGoldenCorpus compares against the golden files checked in to
+// testdata/responses. Rewrite them with WHOISTEST_UPDATE=1.
+func TestCheckGoldenCorpus(t *testing.T) {
+	CheckGolden(t, parseVerisign, Host("whois.verisign-grs.com"), Query("google.com"))
+	if !updating() {
+		_, err := ReadGoldenFS(FS(), "whois.verisign-grs.com/google.com.golden.json")
+		st.Expect(t, err, nil)
+	}
+}
+
+func TestDiffGolden(t *testing.T) {
+	want := &Result{Domain: "example.com", Status: []string{"ok"}}
+	st.Expect(t, diffGolden(want, want), "")
+	got := &Result{Domain: "example.com", Status: []string{"clientHold"}}
+	d := diffGolden(want, got)
+	st.Expect(t, strings.Contains(d, "-\t\t\"ok\""), true)
+	st.Expect(t, strings.Contains(d, "+\t\t\"clientHold\""), true)
+	st.Expect(t, strings.Contains(d, "example.com"), false)
+}
@@ -0,0 +1,174 @@
+package whoistest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/domainr/whois"
+)
+
+// ManifestFilename is the name of the manifest in a response directory.
+const ManifestFilename = "index.json"
+
+// Outcome is the result of a whois query, as detected from its response.
+type Outcome string
+
+// Outcomes.
+const (
+	Registered  Outcome = "registered"   // Domain is registered
+	NotFound    Outcome = "not_found"    // Domain is not registered
+	Reserved    Outcome = "reserved"     // Domain is reserved or restricted
+	RateLimited Outcome = "rate_limited" // Query was refused for exceeding a rate limit
+	Failed      Outcome = "error"        // Query failed, e.g. access denied or empty response
+	Unknown     Outcome = "unknown"      // Outcome could not be detected
+)
+
+// ManifestEntry describes a response file in a Manifest.
+type ManifestEntry struct {
+	Host      string    `json:"host"`
+	Query     string    `json:"query"`
+	Zone      string    `json:"zone"` // Query without its first label
+	FetchedAt time.Time `json:"fetched_at"`
+	MediaType string    `json:"media_type"`
+	Charset   string    `json:"charset,omitempty"`
+	Size      int       `json:"size"`     // Body size in bytes
+	Checksum  string    `json:"checksum"` // Content-Checksum of the body
+	Outcome   Outcome   `json:"outcome"`
+}
+
+// Manifest lists the responses in a response directory, so tools can
+// query the corpus without reading every response file.
+type Manifest struct {
+	Version   int             `json:"version"`
+	Responses []ManifestEntry `json:"responses"` // Sorted by host and query
+}
+
+// Index returns the manifest of the embedded corpus, testdata/responses/index.json.
+func Index() (*Manifest, error) {
+	return ReadManifestFS(FS())
+}
+
+// NewManifest returns a manifest of the responses in c.
+// outcome detects the outcome of each response; see classify.Outcome.
+func NewManifest(c *Corpus, outcome func(*whois.Response) Outcome) *Manifest {
+	m := &Manifest{Version: 1, Responses: make([]ManifestEntry, 0, c.Len())}
+	for _, res := range c.Responses() {
+		m.Responses = append(m.Responses, ManifestEntry{
+			Host:      res.Host,
+			Query:     res.Query,
+			Zone:      zoneOf(res.Query),
+			FetchedAt: res.FetchedAt.UTC(),
+			MediaType: res.MediaType,
+			Charset:   res.Charset,
+			Size:      len(res.Body),
+			Checksum:  res.Checksum(),
+			Outcome:   outcome(res),
+		})
+	}
+	sort.Slice(m.Responses, func(i, j int) bool {
+		a, b := m.Responses[i], m.Responses[j]
+		if a.Host != b.Host {
+			return a.Host < b.Host
+		}
+		return a.Query < b.Query
+	})
+	return m
+}
+
+func zoneOf(query string) string {
+	if i := strings.Index(query, "."); i >= 0 {
+		return query[i+1:]
+	}
+	return ""
+}
+
+// ReadManifest reads a JSON-encoded Manifest from r.
+func ReadManifest(r io.Reader) (*Manifest, error) {
+	var m Manifest
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, err
+	}
+	if m.Version != 1 {
+		return nil, fmt.Errorf("unsupported manifest version %d", m.Version)
+	}
+	return &m, nil
+}
+
+// ReadManifestFS reads the manifest of the response corpus in fsys.
+func ReadManifestFS(fsys fs.FS) (*Manifest, error) {
+	f, err := fsys.Open(ManifestFilename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadManifest(f)
+}
+
+// WriteManifest writes m as indented JSON to the manifest file in dir,
+// replacing it atomically. See WriteResponseFile.
+func WriteManifest(dir string, m *Manifest) error {
+	b, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, ManifestFilename), func(w io.Writer) error {
+		_, err := w.Write(append(b, '\n'))
+		return err
+	})
+}
+
+// Reindex rebuilds the manifest of the response directory dir from the
+// responses in it. Tools that write response files call it afterwards.
+func Reindex(dir string, outcome func(*whois.Response) Outcome) error {
+	c, err := LoadCorpus(dir)
+	if err != nil {
+		return err
+	}
+	return WriteManifest(dir, NewManifest(c, outcome))
+}
+
+// StaleHosts returns the sorted hosts with a response fetched before t.
+func (m *Manifest) StaleHosts(t time.Time) []string {
+	hosts := make(map[string]bool)
+	for _, e := range m.Responses {
+		if e.FetchedAt.Before(t) {
+			hosts[e.Host] = true
+		}
+	}
+	return sortedKeys(hosts)
+}
+
+// ZonesWithout returns the sorted zones with responses, none of which has
+// outcome o, e.g. zones lacking a not-found sample.
+func (m *Manifest) ZonesWithout(o Outcome) []string {
+	zones := make(map[string]bool)
+	for _, e := range m.Responses {
+		if e.Zone == "" {
+			continue
+		}
+		zones[e.Zone] = zones[e.Zone] || e.Outcome == o
+	}
+	var out []string
+	for z, ok := range zones {
+		if !ok {
+			out = append(out, z)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,78 @@
+package whoistest
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/domainr/whois"
+	"github.com/nbio/st"
+)
+
+func TestIndex(t *testing.T) {
+	m, err := Index()
+	st.Assert(t, err, nil)
+	c, err := NewCorpus()
+	st.Assert(t, err, nil)
+	st.Expect(t, len(m.Responses), c.Len())
+	for _, e := range m.Responses {
+		res := c.Responses(Host(e.Host), Query(e.Query))
+		st.Assert(t, len(res), 1)
+		st.Expect(t, e.Checksum, res[0].Checksum())
+		st.Expect(t, e.Size, len(res[0].Body))
+	}
+}
+
+func TestNewManifest(t *testing.T) {
+	c, err := NewCorpus()
+	st.Assert(t, err, nil)
+	c = c.Filter(Host("whois.kr"))
+	m := NewManifest(c, func(res *whois.Response) Outcome {
+		if res.Query == "zx5v7d4v2k50l3pq.kr" {
+			return NotFound
+		}
+		return Registered
+	})
+	st.Expect(t, len(m.Responses), c.Len())
+	e := m.Responses[0]
+	st.Expect(t, e.Host, "whois.kr")
+	st.Expect(t, e.Zone, "kr")
+
+	var buf bytes.Buffer
+	st.Assert(t, json.NewEncoder(&buf).Encode(m), nil)
+	m2, err := ReadManifest(&buf)
+	st.Assert(t, err, nil)
+	st.Expect(t, m2.Responses[0].FetchedAt.Equal(e.FetchedAt), true)
+	st.Expect(t, m2.ZonesWithout(NotFound), []string(nil))
+	st.Expect(t, m2.ZonesWithout(Reserved), []string{"kr"})
+
+	_, err = ReadManifest(bytes.NewBufferString(`{"version":2}`))
+	st.Refute(t, err, nil)
+}
+
+func TestManifestStaleHosts(t *testing.T) {
+	now := time.Now()
+	m := &Manifest{Version: 1, Responses: []ManifestEntry{
+		{Host: "a", FetchedAt: now.Add(-48 * time.Hour)},
+		{Host: "a", FetchedAt: now},
+		{Host: "b", FetchedAt: now},
+	}}
+	st.Expect(t, m.StaleHosts(now.Add(-24*time.Hour)), []string{"a"})
+}
+
+func TestReindex(t *testing.T) {
+	dir := t.TempDir()
+	res := whois.NewResponse("example.com", "whois.example.com")
+	res.Body = []byte("Domain Name: EXAMPLE.COM\r\n")
+	st.Assert(t, WriteResponseFile(filepath.Join(dir, filepath.FromSlash(ResponsePath(res.Query, res.Host))), res), nil)
+	st.Assert(t, Reindex(dir, func(*whois.Response) Outcome { return Registered }), nil)
+
+	m, err := ReadManifestFS(os.DirFS(dir))
+	st.Assert(t, err, nil)
+	st.Assert(t, len(m.Responses), 1)
+	st.Expect(t, m.Responses[0].Query, "example.com")
+	st.Expect(t, m.Responses[0].Outcome, Registered)
+}
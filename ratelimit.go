@@ -0,0 +1,24 @@
+package whoistest
+
+// DefaultRateLimitText is the reply used to simulate a rate-limited query
+// for a host not listed in RateLimitText.
+const DefaultRateLimitText = "Query limit exceeded. Please try again later.\r\n"
+
+// RateLimitText maps whois hosts to the text they are known to return
+// when a client exceeds their query rate limit.
+var RateLimitText = map[string]string{
+	"whois.cnnic.cn": "Your connection limit exceeded. Please slow down and try again later.\r\n",
+	"whois.denic.de": "55000000002 Connection refused; access control limit reached.\r\n",
+	"whois.nic.es": "    The IP address used to perform the query  is not authorised  or  has exceeded the established limit for\r\n" +
+		"    queries.To request access to the service,complete the form located at https://sede.red.gob.es/sede/whois,\r\n" +
+		"    where you may also consult the service conditions.\r\n",
+	"whois.nic.fr": "%% Too many requests...\n",
+}
+
+// rateLimitText returns the rate-limit reply for host.
+func rateLimitText(host string) string {
+	if text, ok := RateLimitText[host]; ok {
+		return text
+	}
+	return DefaultRateLimitText
+}
@@ -0,0 +1,158 @@
+package whoistest
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/domainr/whois"
+)
+
+// RDAPMediaType is the media type of recorded RDAP (RFC 9083) responses.
+const RDAPMediaType = "application/rdap+json"
+
+// RDAPServer is an HTTP server answering RDAP domain, nameserver and
+// entity lookups with recorded application/rdap+json responses from the
+// corpus. It embeds an httptest.Server.
+type RDAPServer struct {
+	*httptest.Server
+
+	corpus *Corpus
+	hosts  map[string]bool
+
+	mu    sync.Mutex
+	limit *faultState
+}
+
+// NewRDAPServer starts and returns a new RDAPServer answering with the
+// recorded RDAP responses in the corpus. The caller should call Close
+// when finished. It panics if the corpus cannot be loaded.
+func NewRDAPServer() *RDAPServer {
+	return newRDAPServer(mustCorpus())
+}
+
+func newRDAPServer(c *Corpus) *RDAPServer {
+	s := &RDAPServer{
+		corpus: c.Filter(MediaType(RDAPMediaType)),
+		hosts:  make(map[string]bool),
+	}
+	for _, h := range s.corpus.Hosts() {
+		s.hosts[h] = true
+	}
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+// SetRateLimit makes the server answer 429 Too Many Requests for requests
+// beyond limit within any sliding window. A limit of 0 disables it; a
+// window of 0 never expires.
+func (s *RDAPServer) SetRateLimit(limit int, window time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limit = &faultState{Fault: Fault{Limit: limit, Window: window}}
+}
+
+// limited records a request and reports whether it exceeds the rate limit.
+func (s *RDAPServer) limited() (bool, time.Duration) {
+	s.mu.Lock()
+	fs := s.limit
+	s.mu.Unlock()
+	if fs == nil {
+		return false, 0
+	}
+	return fs.limited(time.Now()), fs.Window
+}
+
+// Client returns an http.Client that sends every request to this server,
+// whatever its scheme and host. The original host is kept in the Host
+// header, and selects which recorded RDAP server answers.
+func (s *RDAPServer) Client() *http.Client {
+	return &http.Client{Transport: &rdapTransport{s.URL, s.Server.Client().Transport}}
+}
+
+type rdapTransport struct {
+	url string
+	rt  http.RoundTripper
+}
+
+func (t *rdapTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	r.Host = req.URL.Host
+	r.URL.Scheme = "http"
+	r.URL.Host = strings.TrimPrefix(t.url, "http://")
+	return t.rt.RoundTrip(r)
+}
+
+var rdapPath = regexp.MustCompile(`/(domain|nameserver|entity)/([^/]+)$`)
+
+// ServeHTTP implements http.Handler.
+func (s *RDAPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if limited, window := s.limited(); limited {
+		if window > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(window/time.Second)))
+		}
+		rdapError(w, http.StatusTooManyRequests, "Too Many Requests", "Query rate limit exceeded.")
+		return
+	}
+	m := rdapPath.FindStringSubmatch(r.URL.Path)
+	if m == nil {
+		rdapError(w, http.StatusBadRequest, "Bad Request", "Unsupported RDAP query "+r.URL.Path+".")
+		return
+	}
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	res := s.lookup(host, m[1], m[2])
+	if res == nil {
+		rdapError(w, http.StatusNotFound, "Not Found", "No "+m[1]+" found for "+m[2]+".")
+		return
+	}
+	status := http.StatusOK
+	var obj struct {
+		ErrorCode int `json:"errorCode"`
+	}
+	if json.Unmarshal(res.Body, &obj) == nil && obj.ErrorCode != 0 {
+		status = obj.ErrorCode
+	}
+	w.Header().Set("Content-Type", RDAPMediaType)
+	w.WriteHeader(status)
+	w.Write(res.Body)
+}
+
+// lookup returns the recorded RDAP response of class for name, or nil.
+// If the corpus has responses recorded from host, only those are used.
+func (s *RDAPServer) lookup(host, class, name string) *whois.Response {
+	filters := []Filter{Query(name)}
+	if s.hosts[host] {
+		filters = append(filters, Host(host))
+	}
+	for _, res := range s.corpus.Responses(filters...) {
+		var obj struct {
+			ObjectClassName string `json:"objectClassName"`
+		}
+		json.Unmarshal(res.Body, &obj)
+		if obj.ObjectClassName == "" || obj.ObjectClassName == class {
+			return res
+		}
+	}
+	return nil
+}
+
+// rdapError writes an RFC 9083 error response.
+func rdapError(w http.ResponseWriter, code int, title, description string) {
+	w.Header().Set("Content-Type", RDAPMediaType)
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(struct {
+		RDAPConformance []string `json:"rdapConformance"`
+		ErrorCode       int      `json:"errorCode"`
+		Title           string   `json:"title"`
+		Description     []string `json:"description"`
+	}{[]string{"rdap_level_0"}, code, title, []string{description}})
+}
@@ -0,0 +1,119 @@
+package whoistest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/domainr/whois"
+	"github.com/nbio/st"
+)
+
+// writeCorpus writes responses into a temporary response directory.
+func writeCorpus(t *testing.T, responses ...*whois.Response) string {
+	dir := t.TempDir()
+	for _, res := range responses {
+		fn := filepath.Join(dir, res.Host, res.Query+".mime")
+		st.Assert(t, os.MkdirAll(filepath.Dir(fn), 0755), nil)
+		f, err := os.Create(fn)
+		st.Assert(t, err, nil)
+		st.Assert(t, res.WriteMIME(f), nil)
+		st.Assert(t, f.Close(), nil)
+	}
+	return dir
+}
+
+func rdapResponse(query, host, body string) *whois.Response {
+	res := whois.NewResponse(query, host)
+	res.MediaType = RDAPMediaType
+	res.Body = []byte(body)
+	return res
+}
+
+func newTestRDAPServer(t *testing.T) *RDAPServer {
+	dir := writeCorpus(t,
+		rdapResponse("example.com", "rdap.example.com", `{"objectClassName":"domain","ldhName":"EXAMPLE.COM"}`),
+		rdapResponse("ns1.example.com", "rdap.example.com", `{"objectClassName":"nameserver","ldhName":"NS1.EXAMPLE.COM"}`),
+		rdapResponse("example.net", "rdap.example.net", `{"errorCode":404,"title":"Not Found"}`),
+	)
+	c, err := LoadCorpus(dir)
+	st.Assert(t, err, nil)
+	return newRDAPServer(c)
+}
+
+func rdapGet(t *testing.T, s *RDAPServer, url string) (int, map[string]interface{}) {
+	res, err := s.Client().Get(url)
+	st.Assert(t, err, nil)
+	defer res.Body.Close()
+	st.Expect(t, res.Header.Get("Content-Type"), RDAPMediaType)
+	body, err := io.ReadAll(res.Body)
+	st.Assert(t, err, nil)
+	var obj map[string]interface{}
+	st.Assert(t, json.Unmarshal(body, &obj), nil)
+	return res.StatusCode, obj
+}
+
+func TestRDAPServer(t *testing.T) {
+	s := newTestRDAPServer(t)
+	defer s.Close()
+
+	code, obj := rdapGet(t, s, "https://rdap.example.com/v1/domain/example.com")
+	st.Expect(t, code, http.StatusOK)
+	st.Expect(t, obj["ldhName"], "EXAMPLE.COM")
+
+	code, obj = rdapGet(t, s, s.URL+"/nameserver/ns1.example.com")
+	st.Expect(t, code, http.StatusOK)
+	st.Expect(t, obj["objectClassName"], "nameserver")
+
+	code, obj = rdapGet(t, s, s.URL+"/entity/ns1.example.com")
+	st.Expect(t, code, http.StatusNotFound)
+	st.Expect(t, obj["errorCode"], float64(404))
+
+	code, _ = rdapGet(t, s, "https://rdap.example.com/v1/domain/example.net")
+	st.Expect(t, code, http.StatusNotFound)
+
+	code, _ = rdapGet(t, s, "https://rdap.example.net/domain/example.net")
+	st.Expect(t, code, http.StatusNotFound)
+}
+
+func TestRDAPServerRateLimit(t *testing.T) {
+	s := newTestRDAPServer(t)
+	defer s.Close()
+	s.SetRateLimit(1, time.Minute)
+
+	code, _ := rdapGet(t, s, s.URL+"/domain/example.com")
+	st.Expect(t, code, http.StatusOK)
+	code, obj := rdapGet(t, s, s.URL+"/domain/example.com")
+	st.Expect(t, code, http.StatusTooManyRequests)
+	st.Expect(t, obj["errorCode"], float64(429))
+}
+
+func TestWhoisExcludesRDAP(t *testing.T) {
+	res := whois.NewResponse("example.com", "whois.example.com")
+	res.MediaType = "text/plain"
+	res.Body = []byte("Domain Name: EXAMPLE.COM\n")
+	dir := writeCorpus(t, res, rdapResponse("example.com", "rdap.example.com", `{"objectClassName":"domain"}`))
+	c, err := LoadCorpus(dir)
+	st.Assert(t, err, nil)
+	st.Expect(t, len(c.Entries(Whois())), 1)
+
+	s := newServer(c, "")
+	defer s.Close()
+	st.Expect(t, s.Hosts(), []string{"whois.example.com"})
+
+	var hosts []string
+	var mu sync.Mutex
+	t.Run("Run", func(t *testing.T) {
+		c.Run(t, func(t *testing.T, res *whois.Response) {
+			mu.Lock()
+			defer mu.Unlock()
+			hosts = append(hosts, res.Host)
+		})
+	})
+	st.Expect(t, hosts, []string{"whois.example.com"})
+}
@@ -0,0 +1,250 @@
+// Package redact replaces personal data in whois responses, such as
+// registrant names, emails, phone numbers and addresses, with stable
+// pseudonymous values, so recorded corpora can be shared publicly.
+//
+// Contact fields are found with package classify; emails, phone numbers
+// and street addresses are also found by pattern anywhere outside notices. The same input value
+// always yields the same pseudonym under the same key, so responses that
+// share a contact still share it after redaction.
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/domainr/whois"
+	"github.com/domainr/whoistest/classify"
+)
+
+// Redaction records a value replaced in a response.
+// The original value is not recorded.
+type Redaction struct {
+	Line        int    `json:"line"`            // 1-based line number within the response body
+	Kind        string `json:"kind"`            // Kind of value, e.g. name, email, phone or street
+	Field       string `json:"field,omitempty"` // Canonical field of the key, if known
+	Replacement string `json:"replacement"`     // Pseudonymous value
+}
+
+// Redactor redacts whois responses.
+type Redactor struct {
+	// Key keys the pseudonyms. Redactors with the same Key map the same
+	// value to the same pseudonym. A secret Key prevents recovering
+	// values by redacting guesses; nil is a valid, public key.
+	Key []byte
+}
+
+// kinds maps the last element of a contacts.* field to the kind of value
+// it holds. Contact fields not listed, such as country, are kept.
+var kinds = map[string]string{
+	"name":         "name",
+	"organization": "organization",
+	"street":       "street",
+	"city":         "city",
+	"postal_code":  "postal_code",
+	"email":        "email",
+	"phone":        "phone",
+	"phone_ext":    "phone",
+	"fax":          "phone",
+	"fax_ext":      "phone",
+	"id":           "id",
+}
+
+var (
+	reEmail = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)+`)
+	rePhone = regexp.MustCompile(`\+[0-9]{1,3}[ .\-]?[0-9][0-9 .\-]{5,17}[0-9]`)
+
+	// Street addresses in free text, e.g. "123 Main Street" or "Rue de la Loi 16"
+	reStreet = regexp.MustCompile(`(?i)\b[0-9]{1,5}[a-z]?,?[ \t]+(?:[\pL.'\-]+[ \t]+){0,4}(?:street|avenue|road|boulevard|lane|drive|parkway|highway|st|ave|rd|blvd)\b\.?|\b(?:rue|avenue|chauss[ée]e|calle|avenida|rua)[ \t]+(?:[\pL.'\-]+[ \t]+){1,4}[0-9]{1,5}[a-z]?\b|\b[\pL\-]{2,}(?:stra(?:ss|ß)e|straat|str\.|weg|laan|plein|gasse|gatan|gade|vej)[ \t]+[0-9]{1,5}[a-z]?\b`)
+
+	// Values registries already withhold, which need no pseudonym
+	reWithheld = regexp.MustCompile(`(?i)redacted|not disclosed|data protected|withheld|privacy`)
+
+	// Pseudonyms returned by Pseudonym, other than scrambled values
+	rePseudonym = regexp.MustCompile(`^(?:Person [0-9A-F]{8}|Organization [0-9A-F]{8}|\d+ Example Street|City [0-9A-F]{4}|[0-9a-f]{8}@example\.com)$`)
+)
+
+// heuristics find personal data by pattern. Street addresses are only
+// sought in free text and under unknown keys.
+var heuristics = []struct {
+	kind string
+	re   *regexp.Regexp
+}{{"email", reEmail}, {"phone", rePhone}, {"street", reStreet}}
+
+// personal reports whether contact fields with a * role hold personal
+// data within the block opened by a heading for section. Registrar blocks
+// and non-contact sections describe registries and registrars, not people.
+func personal(section string) bool {
+	if section == "registrar" {
+		return false
+	}
+	return !strings.HasPrefix(section, "section.") || strings.HasPrefix(section, "section.contacts")
+}
+
+// kind returns the kind of value held by field, or "" if it is not
+// personal data.
+func kind(field string) string {
+	if !strings.HasPrefix(field, "contacts.") {
+		return ""
+	}
+	i := strings.LastIndex(field, ".")
+	return kinds[strings.TrimSuffix(field[i+1:], "[]")]
+}
+
+// Redact returns a copy of res with personal data replaced, and the
+// redactions made. If nothing is redacted, the copy has the original body.
+// A redacted body is re-encoded as UTF-8. The Content-Checksum and
+// Content-Length headers written by WriteMIME reflect the new body.
+// Pseudonyms are left as they are, except for scrambled phone numbers,
+// postal codes and IDs, which cannot be told from real ones; redact each
+// response once.
+func (r *Redactor) Redact(res *whois.Response) (*whois.Response, []Redaction, error) {
+	out := *res
+	s, err := classify.NewScanner(res)
+	if err != nil {
+		return nil, nil, err
+	}
+	text, err := res.Text()
+	if err != nil {
+		return nil, nil, err
+	}
+	lines := strings.SplitAfter(string(text), "\n")
+
+	var rs []Redaction
+	var block string   // Field of the last bare contact key, for bare values
+	var section string // Field of the heading of the enclosing block
+	for s.Scan() {
+		l := s.Line()
+		if l.Number > len(lines) {
+			break
+		}
+		line := &lines[l.Number-1]
+		var field string
+		switch l.Class {
+		case classify.KeyValue, classify.AltKeyValue:
+			field, _ = classify.Field(l.Key)
+			block = ""
+			if !indented(l.Text) {
+				section = ""
+			}
+			if strings.HasPrefix(field, "section.") {
+				section = field
+			}
+		case classify.BareKey, classify.BareAltKey:
+			block, _ = classify.Field(l.Key)
+			section = block
+			continue
+		case classify.BareValue:
+			field = block
+		case classify.Notice:
+			continue
+		default:
+			block = ""
+		}
+		k := kind(field)
+		if strings.HasPrefix(field, "contacts.*.") && !personal(section) {
+			k = ""
+		}
+		if k != "" && l.Value != "" && !reWithheld.MatchString(l.Value) && !rePseudonym.MatchString(l.Value) {
+			p := r.Pseudonym(k, l.Value)
+			*line = replaceLast(*line, l.Value, p)
+			rs = append(rs, Redaction{Line: l.Number, Kind: k, Field: field, Replacement: p})
+			continue
+		}
+		// Heuristics for values under unknown keys or in free text
+		for _, re := range heuristics {
+			if re.kind == "street" && field != "" {
+				continue
+			}
+			*line = re.re.ReplaceAllStringFunc(*line, func(v string) string {
+				if rePseudonym.MatchString(v) {
+					return v
+				}
+				p := r.Pseudonym(re.kind, v)
+				rs = append(rs, Redaction{Line: l.Number, Kind: re.kind, Field: field, Replacement: p})
+				return p
+			})
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if len(rs) > 0 {
+		out.Body = []byte(strings.Join(lines, ""))
+		out.Charset = "utf-8"
+	}
+	return &out, rs, nil
+}
+
+// Value returns the pseudonym for value v of a canonical field such as
+// contacts.admin.email, or v itself if the field does not hold personal
+// data or the registry already withholds v.
+func (r *Redactor) Value(field, v string) string {
+	k := kind(field)
+	if k == "" || v == "" || reWithheld.MatchString(v) {
+		return v
+	}
+	return r.Pseudonym(k, v)
+}
+
+// Pseudonym returns the pseudonym for value v of kind k, e.g. email.
+// See Redactor.Key.
+func (r *Redactor) Pseudonym(k, v string) string {
+	mac := hmac.New(sha256.New, r.Key)
+	mac.Write([]byte(k))
+	mac.Write([]byte{0})
+	mac.Write([]byte(strings.ToLower(strings.TrimSpace(v))))
+	sum := mac.Sum(nil)
+	id := hex.EncodeToString(sum[:4])
+
+	switch k {
+	case "name":
+		return "Person " + strings.ToUpper(id)
+	case "organization":
+		return "Organization " + strings.ToUpper(id)
+	case "street":
+		return fmt.Sprintf("%d Example Street", 1+(int(sum[4])<<8|int(sum[5]))%999)
+	case "city":
+		return "City " + strings.ToUpper(id[:4])
+	case "email":
+		return id + "@example.com"
+	}
+	// Preserve the shape of phone numbers, postal codes and IDs
+	return scramble(v, sum)
+}
+
+// scramble replaces the digits and letters of v with digits and letters
+// derived from sum, keeping the case and any other characters.
+func scramble(v string, sum []byte) string {
+	b := []byte(v)
+	for i, c := range b {
+		h := sum[i%len(sum)] ^ byte(i/len(sum))
+		switch {
+		case c >= '0' && c <= '9':
+			b[i] = '0' + h%10
+		case c >= 'a' && c <= 'z':
+			b[i] = 'a' + h%26
+		case c >= 'A' && c <= 'Z':
+			b[i] = 'A' + h%26
+		}
+	}
+	return string(b)
+}
+
+// indented reports whether line s begins with white space.
+func indented(s string) bool {
+	return s != "" && (s[0] == ' ' || s[0] == '\t')
+}
+
+// replaceLast replaces the last instance of old in s with new.
+func replaceLast(s, old, new string) string {
+	i := strings.LastIndex(s, old)
+	if i < 0 {
+		return s
+	}
+	return s[:i] + new + s[i+len(old):]
+}
@@ -0,0 +1,145 @@
+package redact
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/domainr/whois"
+	"github.com/domainr/whoistest"
+	"github.com/nbio/st"
+)
+
+func response(body string) *whois.Response {
+	res := whois.NewResponse("example.com", "whois.example.com")
+	res.MediaType = "text/plain"
+	res.Charset = "utf-8"
+	res.Body = []byte(body)
+	return res
+}
+
+func TestRedact(t *testing.T) {
+	res := response("Domain Name: EXAMPLE.COM\r\n" +
+		"Registrant Name: Jane Doe\r\n" +
+		"Registrant Email: jane@example.net\r\n" +
+		"Registrant Phone: +1.4155550100\r\n" +
+		"Registrant Country: US\r\n" +
+		"Admin Name: REDACTED FOR PRIVACY\r\n" +
+		"Contact jane@example.net for details\r\n")
+	var r Redactor
+	out, rs, err := r.Redact(res)
+	st.Assert(t, err, nil)
+	st.Expect(t, len(rs), 4)
+	body := string(out.Body)
+	for _, s := range []string{"Jane Doe", "jane@example.net", "4155550100"} {
+		st.Expect(t, strings.Contains(body, s), false)
+	}
+	for _, s := range []string{"Domain Name: EXAMPLE.COM\r\n", "Registrant Country: US\r\n", "REDACTED FOR PRIVACY"} {
+		st.Expect(t, strings.Contains(body, s), true)
+	}
+
+	// Same input, same pseudonym, across lines and responses
+	email := r.Pseudonym("email", "jane@example.net")
+	st.Expect(t, strings.Count(body, email), 2)
+	st.Expect(t, rs[1], Redaction{Line: 3, Kind: "email", Field: "contacts.registrant.email", Replacement: email})
+	out2, _, err := r.Redact(res)
+	st.Assert(t, err, nil)
+	st.Expect(t, string(out2.Body), body)
+
+	// Pseudonyms are not redacted again
+	_, rs2, err := r.Redact(out)
+	st.Assert(t, err, nil)
+	st.Expect(t, len(rs2), 1) // Scrambled phone number
+
+	// Different key, different pseudonym
+	st.Refute(t, (&Redactor{Key: []byte("secret")}).Pseudonym("email", "jane@example.net"), email)
+
+	// The original is unchanged, and headers follow the new body
+	st.Expect(t, strings.Contains(string(res.Body), "Jane Doe"), true)
+	st.Refute(t, out.Checksum(), res.Checksum())
+}
+
+func TestRedactNothing(t *testing.T) {
+	res := response("Domain Name: EXAMPLE.COM\n")
+	out, rs, err := new(Redactor).Redact(res)
+	st.Assert(t, err, nil)
+	st.Expect(t, len(rs), 0)
+	st.Expect(t, string(out.Body), string(res.Body))
+}
+
+func TestRedactRegistrar(t *testing.T) {
+	res := response("Registrar Technical Contacts:\n" +
+		"\tName:\tJane Doe\n" +
+		"\tEmail:\tjane@example.net\n" +
+		"\n" +
+		"Registrar:\n" +
+		"\tName:\t DNS BE vzw/asbl\n" +
+		"\tWebsite: http://www.dns.be\n" +
+		"\n" +
+		"Registrant:\n" +
+		"\tName:\tJohn Doe\n")
+	out, rs, err := new(Redactor).Redact(res)
+	st.Assert(t, err, nil)
+	st.Expect(t, len(rs), 3)
+	body := string(out.Body)
+	st.Expect(t, strings.Contains(body, "\tName:\t DNS BE vzw/asbl\n"), true)
+	for _, s := range []string{"Jane Doe", "jane@example.net", "John Doe"} {
+		st.Expect(t, strings.Contains(body, s), false)
+	}
+}
+
+func TestRedactStreet(t *testing.T) {
+	var r Redactor
+	for _, s := range []string{
+		"1600 Amphitheatre Parkway",
+		"221b Baker St.",
+		"Rue de la Loi 16",
+		"Hauptstraße 5",
+		"Keizerslaan 12",
+	} {
+		out, rs, err := r.Redact(response("Holder address " + s + "\n"))
+		st.Assert(t, err, nil)
+		st.Assert(t, len(rs), 1)
+		st.Expect(t, strings.Contains(string(out.Body), s), false)
+		st.Expect(t, rs[0].Kind, "street")
+	}
+	for _, s := range []string{
+		"Conditions of use for the whois service via port 43",
+		"Registered 2 years ago",
+		"Status: 3 active\n",
+	} {
+		_, rs, err := r.Redact(response(s + "\n"))
+		st.Assert(t, err, nil)
+		st.Expect(t, len(rs), 0)
+	}
+}
+
+func TestValue(t *testing.T) {
+	var r Redactor
+	st.Expect(t, r.Value("contacts.admin.email", "jane@example.net"), r.Pseudonym("email", "jane@example.net"))
+	st.Expect(t, r.Value("contacts.admin.country", "NZ"), "NZ")
+	st.Expect(t, r.Value("contacts.registrant.name", "REDACTED FOR PRIVACY"), "REDACTED FOR PRIVACY")
+	st.Expect(t, r.Value("registrar", "Example Registrar, Inc."), "Example Registrar, Inc.")
+}
+
+func TestScramble(t *testing.T) {
+	v := (&Redactor{}).Pseudonym("phone", "+1.415-555-0100")
+	st.Expect(t, len(v), len("+1.415-555-0100"))
+	st.Expect(t, v[0], byte('+'))
+	st.Expect(t, v[2], byte('.'))
+	st.Expect(t, v[6], byte('-'))
+}
+
+func TestRedactCorpus(t *testing.T) {
+	var r Redactor
+	whoistest.Run(t, func(t *testing.T, res *whois.Response) {
+		if res.MediaType != "text/plain" {
+			t.Skip("not text")
+		}
+		out, rs, err := r.Redact(res)
+		st.Assert(t, err, nil)
+		lines := strings.Split(string(out.Body), "\n")
+		for _, rd := range rs {
+			st.Expect(t, strings.Contains(lines[rd.Line-1], rd.Replacement), true)
+		}
+	})
+}
@@ -0,0 +1,43 @@
+package whoistest
+
+import (
+	"testing"
+
+	"github.com/domainr/whois"
+)
+
+// Run calls fn for each response in the embedded corpus matching filters.
+// See (*Corpus).Run.
+func Run(t *testing.T, fn func(*testing.T, *whois.Response), filters ...Filter) {
+	t.Helper()
+	c, err := NewCorpus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Run(t, fn, filters...)
+}
+
+// Run calls fn for each whois response in c matching filters, in a parallel
+// subtest named <host>/<query>, so go test -run can select responses by
+// host, query or both, e.g. -run 'TestParse/whois.kr/'.
+// Each call gets its own copy of the response, which fn may modify.
+// If the subtest fails, the path of the response file is logged.
+// Being parallel, the subtests only run and finish after the calling test
+// function returns; to wait for them, call Run inside a t.Run group.
+func (c *Corpus) Run(t *testing.T, fn func(*testing.T, *whois.Response), filters ...Filter) {
+	t.Helper()
+	for _, e := range c.Entries(whoisOnly(filters)...) {
+		e := e
+		t.Run(e.Host+"/"+e.Query, func(t *testing.T) {
+			t.Parallel()
+			t.Cleanup(func() {
+				if t.Failed() {
+					t.Logf("response file: %s", e.Path)
+				}
+			})
+			res := *e.Response
+			res.Body = append([]byte(nil), e.Body...)
+			fn(t, &res)
+		})
+	}
+}
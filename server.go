@@ -0,0 +1,204 @@
+package whoistest
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/domainr/whois"
+)
+
+// Server is a whois (RFC 3912) server listening on a loopback port,
+// answering queries with recorded whois responses from the corpus.
+// Recorded RDAP responses are served by RDAPServer instead.
+// It is modeled on httptest.Server.
+type Server struct {
+	// Addr is the host:port the server is listening on.
+	Addr string
+
+	// Listener is the underlying network listener.
+	Listener net.Listener
+
+	// Host is the whois host whose recorded responses are served.
+	// It is empty for a virtual server, which serves every host.
+	Host string
+
+	corpus *Corpus
+	hosts  map[string]bool
+
+	mu      sync.Mutex
+	remotes map[string]string // client address → impersonated whois host
+	faults  map[faultKey]*faultState
+
+	wg sync.WaitGroup
+}
+
+// NewServer starts and returns a new Server answering queries with the
+// recorded responses for host. The caller should call Close when finished.
+// It panics if the corpus cannot be loaded or the server cannot listen.
+func NewServer(host string) *Server {
+	c := mustCorpus()
+	return newServer(c.Filter(Host(host)), host)
+}
+
+// NewVirtualServer starts and returns a new Server that impersonates every
+// whois host in the corpus from a single listener. Connections made with
+// the server's DialContext or Client are answered as the host they dialed,
+// which lets a full referral chain (e.g. whois.iana.org → whois.kr) be
+// replayed offline. The caller should call Close when finished.
+// It panics if the corpus cannot be loaded or the server cannot listen.
+func NewVirtualServer() *Server {
+	return newServer(mustCorpus(), "")
+}
+
+func mustCorpus() *Corpus {
+	c, err := NewCorpus()
+	if err != nil {
+		panic(fmt.Sprintf("whoistest: failed to load corpus: %v", err))
+	}
+	return c
+}
+
+func newServer(c *Corpus, host string) *Server {
+	c = c.Filter(Whois())
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("whoistest: failed to listen on a port: %v", err))
+	}
+	s := &Server{
+		Addr:     l.Addr().String(),
+		Listener: l,
+		Host:     host,
+		corpus:   c,
+		hosts:    make(map[string]bool),
+		remotes:  make(map[string]string),
+	}
+	for _, h := range c.Hosts() {
+		s.hosts[h] = true
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// Close shuts down the server and blocks until all connections have been closed.
+func (s *Server) Close() {
+	s.Listener.Close()
+	s.wg.Wait()
+}
+
+// Hosts returns the sorted list of whois hosts the server can answer for.
+func (s *Server) Hosts() []string {
+	return s.corpus.Hosts()
+}
+
+// DialContext connects to the server, which answers as the whois host in
+// address. It is suitable for use as whois.Client.DialContext.
+// A virtual server returns an error for hosts not in the corpus, so lookups
+// never escape to the network.
+func (s *Server) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	switch {
+	case s.Host != "":
+		host = s.Host
+	case !s.hosts[host]:
+		return nil, fmt.Errorf("whoistest: no recorded responses for host %s", host)
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, s.Addr)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.remotes[conn.LocalAddr().String()] = host
+	s.mu.Unlock()
+	return conn, nil
+}
+
+// Client returns a whois.Client that connects to this server for every
+// port 43 request, using DialContext.
+func (s *Server) Client() *whois.Client {
+	c := whois.NewClient(whois.DefaultTimeout)
+	c.DialContext = s.DialContext
+	return c
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.Listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+// handle reads a single query line from conn, writes the matching
+// response body subject to any injected Fault, and closes the connection.
+// Unknown queries get an empty response.
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(whois.DefaultTimeout))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	host := s.remoteHost(conn)
+	if err != nil {
+		return
+	}
+	query := parseQuery(line)
+	var body []byte
+	if res := s.lookup(host, query); res != nil {
+		body = res.Body
+	}
+	s.fault(host, query).reply(conn, host, body)
+}
+
+// remoteHost returns and forgets the whois host conn was dialed as.
+// The client registers it in DialContext before sending its query.
+func (s *Server) remoteHost(conn net.Conn) string {
+	addr := conn.RemoteAddr().String()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	host, ok := s.remotes[addr]
+	if !ok {
+		return s.Host
+	}
+	delete(s.remotes, addr)
+	return host
+}
+
+// lookup returns the recorded response for query from host, or nil.
+// If host is empty, the first response for query from any host is used.
+func (s *Server) lookup(host, query string) *whois.Response {
+	filters := []Filter{Query(query)}
+	if host != "" {
+		filters = append(filters, Host(host))
+	}
+	res := s.corpus.Responses(filters...)
+	if len(res) == 0 {
+		return nil
+	}
+	return res[0]
+}
+
+// parseQuery extracts the query from a whois request line, stripping
+// server-specific flags such as the "-T dn,ace " prefix used by
+// whois.denic.de or the "=" prefix used by whois.verisign-grs.com.
+func parseQuery(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.TrimPrefix(fields[len(fields)-1], "=")
+}
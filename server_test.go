@@ -0,0 +1,103 @@
+package whoistest
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/domainr/whois"
+	"github.com/nbio/st"
+)
+
+// readResponse reads the embedded response to query from host.
+func readResponse(query, host string) (*whois.Response, error) {
+	f, err := FS().Open(ResponsePath(query, host))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return whois.ReadMIME(f)
+}
+
+// fetch fetches query from host via s.
+func fetch(t *testing.T, s *Server, query, host string) (*whois.Response, error) {
+	req := &whois.Request{Query: query, Host: host}
+	st.Assert(t, req.Prepare(), nil)
+	return s.Client().Fetch(req)
+}
+
+func TestServer(t *testing.T) {
+	s := NewServer("whois.verisign-grs.com")
+	defer s.Close()
+
+	expected, err := readResponse("google.com", s.Host)
+	st.Assert(t, err, nil)
+
+	req := &whois.Request{Query: "google.com", Host: s.Host}
+	st.Assert(t, req.Prepare(), nil)
+	res, err := s.Client().Fetch(req)
+	st.Assert(t, err, nil)
+	st.Expect(t, res.Host, s.Host)
+	st.Expect(t, string(res.Body), string(expected.Body))
+}
+
+func TestServerNotFound(t *testing.T) {
+	s := NewServer("whois.verisign-grs.com")
+	defer s.Close()
+
+	req := &whois.Request{Query: "google.org", Host: s.Host}
+	st.Assert(t, req.Prepare(), nil)
+	res, err := s.Client().Fetch(req)
+	st.Assert(t, err, nil)
+	st.Expect(t, len(res.Body), 0)
+}
+
+func TestParseQuery(t *testing.T) {
+	st.Expect(t, parseQuery("google.com\r\n"), "google.com")
+	st.Expect(t, parseQuery("=google.com\r\n"), "google.com")
+	st.Expect(t, parseQuery("-T dn,ace google.de\r\n"), "google.de")
+	st.Expect(t, parseQuery("\r\n"), "")
+}
+
+func TestVirtualServerReferral(t *testing.T) {
+	s := NewVirtualServer()
+	defer s.Close()
+	c := s.Client()
+
+	req := &whois.Request{Query: "kr", Host: whois.IANA}
+	st.Assert(t, req.Prepare(), nil)
+	res, err := c.Fetch(req)
+	st.Assert(t, err, nil)
+	m := regexp.MustCompile(`(?m)^whois:\s+(\S+)`).FindSubmatch(res.Body)
+	st.Assert(t, m != nil, true)
+	st.Expect(t, string(m[1]), "whois.kr")
+
+	req = &whois.Request{Query: "google.kr", Host: string(m[1])}
+	st.Assert(t, req.Prepare(), nil)
+	res, err = c.Fetch(req)
+	st.Assert(t, err, nil)
+	expected, err := readResponse("google.kr", "whois.kr")
+	st.Assert(t, err, nil)
+	st.Expect(t, string(res.Body), string(expected.Body))
+}
+
+func TestVirtualServerHosts(t *testing.T) {
+	s := NewVirtualServer()
+	defer s.Close()
+	c := s.Client()
+
+	// The same query is answered differently by each host
+	for _, host := range []string{"whois.inregistry.net", "whois.registry.in"} {
+		req := &whois.Request{Query: "google.in", Host: host}
+		st.Assert(t, req.Prepare(), nil)
+		res, err := c.Fetch(req)
+		st.Assert(t, err, nil)
+		expected, err := readResponse("google.in", host)
+		st.Assert(t, err, nil)
+		st.Expect(t, string(res.Body), string(expected.Body))
+	}
+
+	req := &whois.Request{Query: "google.com", Host: "whois.markmonitor.com"}
+	st.Assert(t, req.Prepare(), nil)
+	_, err := c.Fetch(req)
+	st.Refute(t, err, nil)
+}
@@ -0,0 +1,491 @@
+// Package synth synthesizes plausible whois responses for arbitrary domains
+// from per-host templates learned from recorded responses.
+//
+// A Template keeps the notices, key order and formatting of a host's
+// responses, and replaces the values of known keys (see classify.Field)
+// with values for the synthesized domain. Contact values are replaced with
+// pseudonyms derived from the query, wherever they appear, so recorded
+// contact data is not copied into synthesized responses. A Variation
+// controls edge cases recorded responses rarely cover, such as many
+// nameservers, long contact addresses, DNSSEC records or unusual statuses.
+package synth
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/domainr/whois"
+	"github.com/domainr/whoistest"
+	"github.com/domainr/whoistest/classify"
+	"github.com/domainr/whoistest/redact"
+)
+
+// Variation controls the values in a synthesized response.
+// The zero value reproduces the shape of the template.
+type Variation struct {
+	Nameservers int       // Number of nameservers per run of nameserver lines; 0 keeps the template's count
+	StreetLines int       // Number of street lines per contact; 0 keeps the template's count
+	Status      []string  // Domain statuses; nil keeps the template's
+	DNSSEC      bool      // Sign the domain and add DS records
+	Created     time.Time // Creation date; zero means DefaultCreated
+}
+
+// DefaultCreated is the creation date of synthesized domains when
+// Variation.Created is zero. Updated and expiry dates are derived from it.
+var DefaultCreated = time.Date(2001, time.February, 3, 4, 5, 6, 0, time.UTC)
+
+// Template is a model of the responses of a single whois host.
+type Template struct {
+	Host string
+
+	found    []line // Response for a registered domain
+	notFound []line // Response for an unregistered domain
+	query    string // Query found was recorded for, replaced by new queries
+	notQuery string // Query notFound was recorded for
+	eol      string // Line ending
+}
+
+// line is a line of a template. Lines with a field have their value
+// replaced when synthesizing; other lines are copied with the recorded
+// query replaced.
+type line struct {
+	text  string // Recorded line
+	field string // Canonical field of the key or value, if known
+	value string // Recorded value, if field is set
+	more  []line // Following lines of a repeated field, merged into this one
+}
+
+// prefix and suffix return the text around the value of l.
+func (l line) prefix() string {
+	return l.text[:strings.LastIndex(l.text, l.value)]
+}
+
+func (l line) suffix() string {
+	return l.text[strings.LastIndex(l.text, l.value)+len(l.value):]
+}
+
+// errNoResponses is returned by Learn for a host without responses to
+// learn from.
+var errNoResponses = errors.New("no registered or not-found text responses")
+
+// Learn learns a Template for host from its recorded text responses,
+// chosen by their classify.Outcome. The template for registered domains
+// is the registered response with the most distinct known fields,
+// preferring responses only about the query domain over e.g. lists of
+// matching records. The template for unregistered domains is the first
+// not-found response. Reserved, rate-limited, failed and unknown
+// responses are not used. Returns an error if neither is found.
+func Learn(host string, rs []*whois.Response) (*Template, error) {
+	t := &Template{Host: host}
+	best, bestDomain := 0, false
+	for _, res := range rs {
+		if res.Host != host || res.MediaType != "text/plain" {
+			continue
+		}
+		outcome := classify.Outcome(res)
+		if outcome != whoistest.Registered && outcome != whoistest.NotFound {
+			continue
+		}
+		lines, err := classify.Lines(res)
+		if err != nil {
+			return nil, fmt.Errorf("%s/%s: %s", res.Host, res.Query, err)
+		}
+		tl, fields := learnLines(lines)
+		if outcome == whoistest.NotFound {
+			if t.notFound == nil {
+				t.notFound, t.notQuery = tl, res.Query
+			}
+			continue
+		}
+		score := len(fields)
+		for f, n := range fields {
+			if !repeated(f) {
+				score -= n - 1 // Records for other domains repeat fields
+			}
+		}
+		domain := isDomain(tl, res.Query)
+		if t.found == nil || domain && !bestDomain || domain == bestDomain && score > best {
+			best, bestDomain = score, domain
+			t.found, t.query = tl, res.Query
+			t.eol = "\n"
+			if strings.Contains(string(res.Body), "\r\n") {
+				t.eol = "\r\n"
+			}
+		}
+	}
+	if t.found == nil && t.notFound == nil {
+		return nil, fmt.Errorf("%w for %s", errNoResponses, host)
+	}
+	if t.eol == "" {
+		t.eol = "\n"
+	}
+	return t, nil
+}
+
+// LearnCorpus learns a Template for each host in c with registered or
+// not-found text responses. See Learn.
+func LearnCorpus(c *whoistest.Corpus) (map[string]*Template, error) {
+	c = c.Filter(whoistest.MediaType("text/plain"))
+	ts := make(map[string]*Template)
+	for _, host := range c.Hosts() {
+		t, err := Learn(host, c.Responses(whoistest.Host(host)))
+		if errors.Is(err, errNoResponses) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		ts[host] = t
+	}
+	return ts, nil
+}
+
+// learnLines converts classified lines into template lines, merging
+// consecutive lines of the same repeated field. It returns the lines, the
+// number of lines with each known field.
+func learnLines(lines []classify.Line) (tl []line, fields map[string]int) {
+	fields = make(map[string]int)
+	var block string // Field of the last bare key, for bare values
+	for _, l := range lines {
+		tl1 := line{text: l.Text}
+		switch l.Class {
+		case classify.KeyValue, classify.AltKeyValue:
+			tl1.field, _ = classify.Field(l.Key)
+			tl1.value = l.Value
+			block = ""
+		case classify.BareKey, classify.BareAltKey:
+			block, _ = classify.Field(l.Key)
+		case classify.BareValue:
+			if strings.HasSuffix(block, "[]") {
+				tl1.field, tl1.value = block, l.Value
+			}
+		case classify.Empty:
+			block = ""
+		}
+		if strings.HasPrefix(tl1.field, "section.") {
+			tl1.field = ""
+		}
+		if tl1.field != "" {
+			fields[tl1.field]++
+		}
+		if n := len(tl); n > 0 && repeated(tl1.field) && tl[n-1].field == tl1.field {
+			tl[n-1].more = append(tl[n-1].more, tl1)
+			continue
+		}
+		tl = append(tl, tl1)
+	}
+	return tl, fields
+}
+
+// isDomain reports whether tl holds a domain field, and all its domain
+// fields are query, as opposed to e.g. a list of matching records.
+func isDomain(tl []line, query string) bool {
+	var ok bool
+	for _, l := range tl {
+		if l.field == "domain" {
+			if !strings.EqualFold(l.value, query) {
+				return false
+			}
+			ok = true
+		}
+	}
+	return ok
+}
+
+func repeated(field string) bool {
+	return strings.HasSuffix(field, "[]")
+}
+
+// Synthesize returns a response for a registered domain query, shaped
+// like the host's responses and varied by v.
+// Returns an error if the template has no registered domain response.
+func (t *Template) Synthesize(query string, v Variation) (*whois.Response, error) {
+	if t.found == nil {
+		return nil, fmt.Errorf("no template for registered domains on %s", t.Host)
+	}
+	// Without DNSSEC lines in the template, add them after the nameservers
+	signAfter := -1
+	if v.DNSSEC && !t.hasField("dnssec.signed") && !t.hasField("dnssec.ds[]") {
+		for i, l := range t.found {
+			if l.field == "nameservers[]" && keyOf(l.prefix()) != "" {
+				signAfter = i
+			}
+		}
+	}
+
+	var out []string
+	ns := 0 // Nameservers so far, to number them across runs
+	contacts := t.contacts(query)
+	for i, l := range t.found {
+		switch {
+		case l.field == "":
+			out = append(out, contacts.Replace(replaceQuery(l.text, t.query, query)))
+		case repeated(l.field):
+			for _, val := range t.values(l, query, v, &ns) {
+				out = append(out, l.prefix()+scrub(contacts, l, val)+l.suffix())
+			}
+		default:
+			out = append(out, l.prefix()+scrub(contacts, l, t.value(l, query, v))+l.suffix())
+		}
+		if v.DNSSEC && l.field == "dnssec.signed" && !t.hasField("dnssec.ds[]") {
+			// Add DS records in the style of the DNSSEC line
+			pre := rekey(l.prefix(), "DNSSEC DS Data")
+			for _, ds := range dsRecords(query) {
+				out = append(out, pre+ds+l.suffix())
+			}
+		}
+		if i == signAfter {
+			out = append(out, rekey(l.prefix(), "DNSSEC")+"signedDelegation"+l.suffix())
+			for _, ds := range dsRecords(query) {
+				out = append(out, rekey(l.prefix(), "DNSSEC DS Data")+ds+l.suffix())
+			}
+		}
+	}
+	return t.response(query, out), nil
+}
+
+// NotFound returns a response for an unregistered domain query.
+// Returns an error if the template has no unregistered domain response.
+func (t *Template) NotFound(query string) (*whois.Response, error) {
+	if t.notFound == nil {
+		return nil, fmt.Errorf("no template for unregistered domains on %s", t.Host)
+	}
+	out := make([]string, 0, len(t.notFound))
+	for _, l := range t.notFound {
+		out = append(out, replaceQuery(l.text, t.notQuery, query))
+		for _, m := range l.more {
+			out = append(out, replaceQuery(m.text, t.notQuery, query))
+		}
+	}
+	return t.response(query, out), nil
+}
+
+func (t *Template) response(query string, lines []string) *whois.Response {
+	res := whois.NewResponse(query, t.Host)
+	res.MediaType = "text/plain"
+	res.Charset = "utf-8"
+	res.Body = []byte(strings.Join(lines, t.eol) + t.eol)
+	return res
+}
+
+func (t *Template) hasField(field string) bool {
+	for _, l := range t.found {
+		if l.field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// value returns the synthesized value of a non-repeated field.
+func (t *Template) value(l line, query string, v Variation) string {
+	created := v.Created
+	if created.IsZero() {
+		created = DefaultCreated
+	}
+	switch {
+	case l.field == "domain" || l.field == "query":
+		return matchCase(query, l.value)
+	case l.field == "dates.created":
+		return date(l.value, created)
+	case l.field == "dates.updated" || l.field == "dates.transferred":
+		return date(l.value, created.AddDate(1, 0, 0))
+	case l.field == "dates.expires":
+		return date(l.value, created.AddDate(10, 0, 0))
+	case strings.HasPrefix(l.field, "contacts."):
+		return contact(l, query)
+	case l.field == "dnssec.signed" && v.DNSSEC:
+		switch strings.ToLower(l.value) {
+		case "false":
+			return "true"
+		case "no":
+			return "yes"
+		}
+		return "signedDelegation"
+	}
+	return replaceQuery(l.value, t.query, query)
+}
+
+// values returns the synthesized values of a repeated field.
+// Nameservers are numbered from *ns+1, and *ns is advanced past them.
+func (t *Template) values(l line, query string, v Variation, ns *int) []string {
+	n := 1 + len(l.more)
+	switch {
+	case l.field == "nameservers[]":
+		if v.Nameservers > 0 {
+			n = v.Nameservers
+		}
+		vals := make([]string, n)
+		for i := range vals {
+			*ns++
+			vals[i] = matchCase(fmt.Sprintf("ns%d.%s", *ns, query), l.value)
+		}
+		return vals
+	case l.field == "status[]" && v.Status != nil:
+		return v.Status
+	case strings.HasSuffix(l.field, ".street[]"):
+		if v.StreetLines > 0 {
+			n = v.StreetLines
+		}
+		vals := make([]string, n)
+		for i := range vals {
+			vals[i] = fmt.Sprintf("%d Example Street", i+1)
+		}
+		return vals
+	case l.field == "dnssec.ds[]" && v.DNSSEC:
+		return dsRecords(query)
+	}
+	if strings.HasPrefix(l.field, "contacts.") {
+		vals := []string{contact(l, query)}
+		for _, m := range l.more {
+			vals = append(vals, contact(line{field: l.field, value: m.value}, query))
+		}
+		return vals
+	}
+	vals := []string{replaceQuery(l.value, t.query, query)}
+	for _, m := range l.more {
+		vals = append(vals, replaceQuery(m.value, t.query, query))
+	}
+	return vals
+}
+
+// contact returns a value for the contact field of l, derived from query
+// and the field, so recorded contact data never reaches a synthesized
+// response. Values the registry withholds, and fields such as country
+// that are not personal data, are kept.
+func contact(l line, query string) string {
+	r := &redact.Redactor{Key: []byte(strings.ToLower(query) + "\x00" + l.field)}
+	return r.Value(l.field, l.value)
+}
+
+// contacts returns a Replacer of the recorded contact values in the
+// template with their synthesized values, for contact data repeated in
+// free text or under unknown keys, e.g. a postal code in an address line.
+// Values under 4 characters are left alone, as they may be part of
+// unrelated text.
+func (t *Template) contacts(query string) *strings.Replacer {
+	seen := make(map[string]bool)
+	var vals []line
+	for _, l := range t.found {
+		if !strings.HasPrefix(l.field, "contacts.") {
+			continue
+		}
+		for _, m := range append([]line{l}, l.more...) {
+			if utf8.RuneCountInString(m.value) >= 4 && !seen[m.value] {
+				seen[m.value] = true
+				vals = append(vals, line{field: l.field, value: m.value})
+			}
+		}
+	}
+	// Replace longer values first, e.g. a street before its city
+	sort.SliceStable(vals, func(i, j int) bool { return len(vals[i].value) > len(vals[j].value) })
+	var oldnew []string
+	for _, l := range vals {
+		if p := contact(l, query); p != l.value {
+			oldnew = append(oldnew, l.value, p)
+		}
+	}
+	return strings.NewReplacer(oldnew...)
+}
+
+// scrub replaces recorded contact values in the synthesized value val of
+// l, unless val is itself a synthesized contact value.
+func scrub(contacts *strings.Replacer, l line, val string) string {
+	if strings.HasPrefix(l.field, "contacts.") && val != l.value {
+		return val
+	}
+	return contacts.Replace(val)
+}
+
+// date formats d in the layout of the recorded date, or returns the
+// recorded date if its layout is unknown.
+func date(recorded string, d time.Time) string {
+	layout := dateLayout(recorded)
+	if layout == "" {
+		return recorded
+	}
+	return d.Format(layout)
+}
+
+// dateLayouts are candidate date layouts, in order of preference.
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05Z",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"2006/01/02",
+	"2006. 01. 02.",
+	"02-Jan-2006 15:04:05 MST",
+	"02-Jan-2006",
+	"Mon Jan 02 15:04:05 MST 2006",
+	"Mon Jan 2 2006",
+	"January _2 2006",
+	"20060102",
+}
+
+// dateLayout returns the first of dateLayouts that parses s, or "".
+func dateLayout(s string) string {
+	for _, layout := range dateLayouts {
+		if _, err := time.Parse(layout, s); err == nil {
+			return layout
+		}
+	}
+	return ""
+}
+
+// dsRecords returns a DS record for query, as key tag, algorithm (8, RSA/SHA-256),
+// digest type (2, SHA-256) and digest. The record is derived from query, so
+// it is stable across runs.
+func dsRecords(query string) []string {
+	h := sha256.Sum256([]byte(strings.ToLower(query)))
+	tag := int(h[0])<<8 | int(h[1])
+	return []string{fmt.Sprintf("%d 8 2 %X", tag, h[:])}
+}
+
+// keyOf returns the key in a line prefix such as "   Name Server: ".
+func keyOf(prefix string) string {
+	k := strings.TrimSpace(prefix)
+	k = strings.TrimSuffix(k, ":")
+	k = strings.TrimPrefix(k, "[")
+	k = strings.TrimSuffix(k, "]")
+	return strings.TrimSpace(k)
+}
+
+// rekey replaces the key in a line prefix such as "Name Server:   " with key,
+// keeping values aligned where the prefix pads the key with spaces.
+func rekey(prefix, key string) string {
+	old := keyOf(prefix)
+	i := strings.Index(prefix, old)
+	rest := prefix[i+len(old):]
+	trimmed := strings.TrimLeft(rest, " ")
+	if pad := len(rest) - len(trimmed); pad > 0 {
+		pad += utf8.RuneCountInString(old) - utf8.RuneCountInString(key)
+		if pad < 1 {
+			pad = 1
+		}
+		rest = strings.Repeat(" ", pad) + trimmed
+	}
+	return prefix[:i] + key + rest
+}
+
+// replaceQuery replaces recorded in s with query, in the case it appears.
+func replaceQuery(s, recorded, query string) string {
+	if recorded == "" {
+		return s
+	}
+	s = strings.ReplaceAll(s, strings.ToUpper(recorded), strings.ToUpper(query))
+	return strings.ReplaceAll(s, strings.ToLower(recorded), strings.ToLower(query))
+}
+
+// matchCase returns s upper-cased if like is upper case.
+func matchCase(s, like string) string {
+	if like != "" && like == strings.ToUpper(like) && like != strings.ToLower(like) {
+		return strings.ToUpper(s)
+	}
+	return s
+}
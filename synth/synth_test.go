@@ -0,0 +1,198 @@
+package synth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/domainr/whoistest"
+	"github.com/domainr/whoistest/classify"
+	"github.com/domainr/whoistest/redact"
+	"github.com/nbio/st"
+)
+
+func learn(t *testing.T, host string) *Template {
+	c, err := whoistest.NewCorpus()
+	st.Assert(t, err, nil)
+	tmpl, err := Learn(host, c.Responses(whoistest.Host(host)))
+	st.Assert(t, err, nil)
+	return tmpl
+}
+
+// fieldValues returns the non-empty values of the lines of body with field.
+func fieldValues(t *testing.T, tmpl *Template, body []byte, field string) []string {
+	res := tmpl.response("", strings.Split(strings.TrimRight(string(body), "\r\n"), tmpl.eol))
+	lines, err := classify.Lines(res)
+	st.Assert(t, err, nil)
+	var vals []string
+	for _, l := range lines {
+		if f, _ := classify.Field(l.Key); l.Value != "" && f == field {
+			vals = append(vals, l.Value)
+		}
+	}
+	return vals
+}
+
+func TestSynthesize(t *testing.T) {
+	tmpl := learn(t, "whois.pir.org")
+	res, err := tmpl.Synthesize("example.org", Variation{
+		Nameservers: 13,
+		Status:      []string{"serverHold https://icann.org/epp#serverHold"},
+		DNSSEC:      true,
+		Created:     time.Date(1999, time.December, 31, 23, 59, 59, 0, time.UTC),
+	})
+	st.Assert(t, err, nil)
+	st.Expect(t, res.Host, "whois.pir.org")
+	st.Expect(t, res.Query, "example.org")
+
+	st.Expect(t, fieldValues(t, tmpl, res.Body, "domain"), []string{"EXAMPLE.ORG"})
+	ns := fieldValues(t, tmpl, res.Body, "nameservers[]")
+	st.Expect(t, len(ns), 13)
+	st.Expect(t, strings.EqualFold(ns[12], "ns13.example.org"), true)
+	st.Expect(t, fieldValues(t, tmpl, res.Body, "status[]"), []string{"serverHold https://icann.org/epp#serverHold"})
+	st.Expect(t, fieldValues(t, tmpl, res.Body, "dates.created"), []string{"1999-12-31T23:59:59Z"})
+	st.Expect(t, fieldValues(t, tmpl, res.Body, "dnssec.signed"), []string{"signedDelegation"})
+	st.Expect(t, len(fieldValues(t, tmpl, res.Body, "dnssec.ds[]")), 1)
+	st.Expect(t, strings.Contains(strings.ToLower(string(res.Body)), "google"), false)
+}
+
+func TestSynthesizeZero(t *testing.T) {
+	for _, host := range []string{"whois.iana.org", "whois.registro.br"} {
+		tmpl := learn(t, host)
+		var want []string
+		for _, l := range tmpl.found {
+			if l.field == "dnssec.ds[]" {
+				want = append(want, l.value)
+				for _, m := range l.more {
+					want = append(want, m.value)
+				}
+			}
+		}
+		st.Refute(t, len(want), 0)
+		res, err := tmpl.Synthesize("example.test", Variation{})
+		st.Assert(t, err, nil)
+		st.Expect(t, fieldValues(t, tmpl, res.Body, "dnssec.ds[]"), want)
+	}
+}
+
+func TestSynthesizeContacts(t *testing.T) {
+	c, err := whoistest.NewCorpus()
+	st.Assert(t, err, nil)
+	ts, err := LearnCorpus(c)
+	st.Assert(t, err, nil)
+	var r redact.Redactor
+	for host, tmpl := range ts {
+		if tmpl.found == nil {
+			continue
+		}
+		res, err := tmpl.Synthesize("example.test", Variation{})
+		st.Assert(t, err, nil)
+		for _, l := range tmpl.found {
+			for _, l := range append([]line{l}, l.more...) {
+				if !strings.HasPrefix(l.field, "contacts.") || r.Value(l.field, l.value) == l.value {
+					continue
+				}
+				if strings.Contains(string(res.Body), l.value) {
+					t.Errorf("%s: recorded %s value %q in synthesized response", host, l.field, l.value)
+				}
+			}
+		}
+	}
+}
+
+func TestSynthesizeStreet(t *testing.T) {
+	tmpl := learn(t, "whois.jprs.jp")
+	for _, n := range []int{1, 5} {
+		res, err := tmpl.Synthesize("example.jp", Variation{StreetLines: n})
+		st.Assert(t, err, nil)
+		var streets int
+		for _, l := range tmpl.found {
+			if strings.HasSuffix(l.field, ".street[]") {
+				streets++
+			}
+		}
+		if streets == 0 {
+			t.Skip("no street lines in whois.jprs.jp template")
+		}
+		st.Expect(t, strings.Count(string(res.Body), "Example Street"), streets*n)
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	tmpl := learn(t, "whois.verisign-grs.com")
+	res, err := tmpl.NotFound("nonexistent-example.com")
+	st.Assert(t, err, nil)
+	lines, err := classify.Lines(res)
+	st.Assert(t, err, nil)
+	var found bool
+	for _, l := range lines {
+		if l.Class == classify.NotFound {
+			found = true
+			st.Expect(t, strings.Contains(strings.ToLower(l.Text), "nonexistent-example.com"), true)
+		}
+	}
+	st.Expect(t, found, true)
+}
+
+func TestLearnCorpus(t *testing.T) {
+	c, err := whoistest.NewCorpus()
+	st.Assert(t, err, nil)
+	ts, err := LearnCorpus(c)
+	st.Assert(t, err, nil)
+	st.Refute(t, len(ts), 0)
+	for host, tmpl := range ts {
+		if tmpl.found == nil {
+			continue
+		}
+		res, err := tmpl.Synthesize("example.test", Variation{Nameservers: 3, DNSSEC: true})
+		st.Assert(t, err, nil)
+		st.Refute(t, len(res.Body), 0)
+		st.Expect(t, res.Host, host)
+	}
+}
+
+func TestLearnCorpusTemplates(t *testing.T) {
+	c, err := whoistest.NewCorpus()
+	st.Assert(t, err, nil)
+	ts, err := LearnCorpus(c)
+	st.Assert(t, err, nil)
+	for _, tt := range []struct {
+		host, query, notQuery string
+	}{
+		{"whois.nic.uk", "google.co.uk", "zx5v7d4v2k50l3pq.co.uk"},
+		{"whois.fi", "google.fi", "zx5v7d4v2k50l3pq.fi"},
+		{"whois.nic.fr", "whois.fr", "zx5v7d4v2k50l3pq.fr"}, // Not the rate-limited nic.fr
+		{"whois.kr", "google.kr", "zx5v7d4v2k50l3pq.kr"},    // Not the reserved nic.kr
+	} {
+		tmpl := ts[tt.host]
+		st.Assert(t, tmpl != nil, true)
+		st.Expect(t, tmpl.query, tt.query)
+		st.Expect(t, tmpl.notQuery, tt.notQuery)
+	}
+
+	// Every whois.nic.es response is an access-denied notice
+	_, ok := ts["whois.nic.es"]
+	st.Expect(t, ok, false)
+	_, err = Learn("whois.nic.es", c.Responses(whoistest.Host("whois.nic.es")))
+	st.Refute(t, err, nil)
+}
+
+func TestDateLayout(t *testing.T) {
+	d := time.Date(2021, time.March, 4, 5, 6, 7, 0, time.UTC)
+	for _, tt := range []struct{ recorded, want string }{
+		{"2003-03-10 19:06:34", "2021-03-04 05:06:07"},
+		{"2007. 08. 21.", "2021. 03. 04."},
+		{"16-Feb-2005 06:32:17 UTC", "04-Mar-2021 05:06:07 UTC"},
+		{"March  8 2000", "March  4 2021"},
+		{"19980120 #83037", "19980120 #83037"},
+	} {
+		st.Expect(t, date(tt.recorded, d), tt.want)
+	}
+}
+
+func TestRekey(t *testing.T) {
+	st.Expect(t, rekey("Name Server: ", "DNSSEC"), "DNSSEC: ")
+	st.Expect(t, rekey("   Name Server:", "DNSSEC DS Data"), "   DNSSEC DS Data:")
+	st.Expect(t, rekey("DNSSEC         : ", "DNSSEC DS Data"), "DNSSEC DS Data : ")
+	st.Expect(t, rekey("DNSSEC  : ", "DNSSEC DS Data"), "DNSSEC DS Data : ")
+}
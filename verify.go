@@ -0,0 +1,122 @@
+package whoistest
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/mail"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Mismatch describes a response file header that disagrees with the
+// file's body or location.
+type Mismatch struct {
+	Path   string // Path of the response file
+	Header string // Header name, e.g. Content-Checksum
+	Want   string // Value computed from the body or location
+	Got    string // Value of the header
+}
+
+// Error implements the error interface.
+func (m *Mismatch) Error() string {
+	return fmt.Sprintf("%s: %s is %q, expected %q", m.Path, m.Header, m.Got, m.Want)
+}
+
+// Verify checks every response file in the embedded corpus, FS().
+// See VerifyFile.
+func Verify() ([]*Mismatch, error) {
+	return verifySource(&source{FS(), sourceDir()})
+}
+
+// VerifyDir checks every <host>/<query>.mime response file under dir.
+// See VerifyFile.
+func VerifyDir(dir string) ([]*Mismatch, error) {
+	return verifySource(&source{os.DirFS(dir), dir})
+}
+
+// VerifyFS checks every <host>/<query>.mime response file in fsys.
+// See VerifyFile.
+func VerifyFS(fsys fs.FS) ([]*Mismatch, error) {
+	return verifySource(&source{fsys, ""})
+}
+
+func verifySource(src *source) ([]*Mismatch, error) {
+	var out []*Mismatch
+	err := fs.WalkDir(src.fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if name != "." && strings.Contains(name, "/") {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if path.Ext(name) != ".mime" || !strings.Contains(name, "/") {
+			return nil
+		}
+		f, err := src.fsys.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		ms, err := verify(src.path(name), name, f)
+		out = append(out, ms...)
+		return err
+	})
+	return out, err
+}
+
+// VerifyFile checks that the Content-Checksum and Content-Length headers of
+// the response file fn match its body, and that its Host and Query headers
+// match the directory and file name ResponseFilename would produce.
+// It returns any mismatches, or an error if fn cannot be read.
+func VerifyFile(fn string) ([]*Mismatch, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return verify(fn, filepath.ToSlash(fn), f)
+}
+
+// verify checks the response file read from r, named name with slashes,
+// reporting mismatches and errors against fn.
+func verify(fn, name string, r io.Reader) ([]*Mismatch, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", fn, err)
+	}
+	body, err := io.ReadAll(msg.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", fn, err)
+	}
+
+	h := sha1.Sum(body)
+	want := map[string]string{
+		"Content-Checksum": hex.EncodeToString(h[:]),
+		"Content-Length":   strconv.Itoa(len(body)),
+		"Host":             path.Base(path.Dir(name)),
+	}
+	if q := path.Base(name); path.Ext(q) == ".mime" {
+		want["Query"] = q[:len(q)-len(".mime")]
+	}
+
+	var out []*Mismatch
+	for _, k := range []string{"Content-Checksum", "Content-Length", "Host", "Query"} {
+		w, ok := want[k]
+		if !ok {
+			continue
+		}
+		if got := msg.Header.Get(k); got != w {
+			out = append(out, &Mismatch{Path: fn, Header: k, Want: w, Got: got})
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,66 @@
+package whoistest
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/domainr/whois"
+	"github.com/nbio/st"
+)
+
+func TestVerify(t *testing.T) {
+	ms, err := Verify()
+	st.Assert(t, err, nil)
+	for _, m := range ms {
+		t.Error(m)
+	}
+}
+
+func TestVerifyFile(t *testing.T) {
+	res := whois.NewResponse("example.com", "whois.example.com")
+	res.Body = []byte("Domain Name: EXAMPLE.COM\r\n")
+	dir := writeCorpus(t, res)
+	fn := filepath.Join(dir, "whois.example.com", "example.com.mime")
+
+	ms, err := VerifyFile(fn)
+	st.Assert(t, err, nil)
+	st.Expect(t, len(ms), 0)
+
+	// Hand-edit the body and move the file
+	b, err := os.ReadFile(fn)
+	st.Assert(t, err, nil)
+	b = []byte(strings.Replace(string(b), "EXAMPLE.COM", "EXAMPLE.NET", 1))
+	fn = filepath.Join(dir, "whois.example.com", "example.net.mime")
+	st.Assert(t, os.WriteFile(fn, b, 0644), nil)
+
+	ms, err = VerifyDir(dir)
+	st.Assert(t, err, nil)
+	var headers []string
+	for _, m := range ms {
+		headers = append(headers, m.Header)
+	}
+	st.Expect(t, headers, []string{"Content-Checksum", "Query"})
+	st.Expect(t, ms[1].Want, "example.net")
+	st.Expect(t, ms[1].Got, "example.com")
+}
+
+func TestVerifyFS(t *testing.T) {
+	res := whois.NewResponse("example.com", "whois.example.com")
+	res.Body = []byte("Domain Name: EXAMPLE.COM\r\n")
+	var buf bytes.Buffer
+	st.Assert(t, res.WriteMIME(&buf), nil)
+	fsys := fstest.MapFS{
+		"index.json":                         {Data: []byte("{}")},
+		"whois.example.com/example.com.mime": {Data: buf.Bytes()},
+		"whois.example.net/example.com.mime": {Data: buf.Bytes()},
+	}
+	ms, err := VerifyFS(fsys)
+	st.Assert(t, err, nil)
+	st.Assert(t, len(ms), 1)
+	st.Expect(t, ms[0].Path, "whois.example.net/example.com.mime")
+	st.Expect(t, ms[0].Header, "Host")
+}
@@ -1,6 +1,10 @@
 package whoistest
 
 import (
+	"embed"
+	"io/fs"
+	"os"
+	"path"
 	"path/filepath"
 	"runtime"
 )
@@ -10,14 +14,64 @@ var (
 	_dir           = filepath.Dir(_file)
 )
 
+//go:embed testdata
+var testdata embed.FS
+
+// Testdata returns the embedded testdata directory, which holds the
+// responses directory, prefixes.txt and fields.json.
+// It is available even when the source tree is not, e.g. in binaries
+// built with -trimpath or from a read-only module cache.
+func Testdata() fs.FS {
+	sub, err := fs.Sub(testdata, "testdata")
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+// FS returns the embedded response corpus, laid out as <host>/<query>.mime.
+func FS() fs.FS {
+	sub, err := fs.Sub(Testdata(), "responses")
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
 // ResponseFiles returns a slice of paths to MIME-encoded whois responses.
 // Returns nil, error if any errors occur.
+// The paths are in the source tree; see FS for the embedded responses.
 func ResponseFiles() ([]string, error) {
 	return filepath.Glob(filepath.Join(_dir, "testdata", "responses", "*", "*.mime"))
 }
 
 // ResponseFilename returns a fully-qualified path to a response file
 // for the given query and host.
+// The path is in the source tree; see ResponsePath for use with FS.
 func ResponseFilename(query, host string) string {
 	return filepath.Join(_dir, "testdata", "responses", host, query+".mime")
 }
+
+// ResponseFilesFS returns a slice of slash-separated paths to
+// MIME-encoded whois responses in fsys.
+// Returns nil, error if any errors occur.
+func ResponseFilesFS(fsys fs.FS) ([]string, error) {
+	return fs.Glob(fsys, "*/*.mime")
+}
+
+// ResponsePath returns the slash-separated path to a response file for
+// the given query and host, relative to the root of a response corpus
+// such as FS.
+func ResponsePath(query, host string) string {
+	return path.Join(host, query+".mime")
+}
+
+// sourceDir returns the testdata/responses directory of the source tree,
+// or "" if it is unavailable.
+func sourceDir() string {
+	dir := filepath.Join(_dir, "testdata", "responses")
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		return ""
+	}
+	return dir
+}
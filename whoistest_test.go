@@ -1,7 +1,8 @@
 package whoistest
 
 import (
-	"fmt"
+	"io/fs"
+	"sync"
 	"testing"
 
 	"github.com/domainr/whois"
@@ -12,9 +13,60 @@ func TestResponseFiles(t *testing.T) {
 	fns, err := ResponseFiles()
 	st.Assert(t, err, nil)
 	for _, fn := range fns {
-		fmt.Printf("%s\n", fn)
 		res, err := whois.ReadMIMEFile(fn)
 		st.Refute(t, res, nil)
 		st.Assert(t, err, nil)
 	}
 }
+
+func TestRun(t *testing.T) {
+	c, err := NewCorpus()
+	st.Assert(t, err, nil)
+	bodies := make(map[string]string)
+	for _, e := range c.Entries() {
+		bodies[e.Path] = string(e.Body)
+	}
+	var mu sync.Mutex
+	seen := make(map[string]bool)
+	t.Run("all", func(t *testing.T) {
+		c.Run(t, func(t *testing.T, res *whois.Response) {
+			st.Refute(t, res.Host, "")
+			st.Refute(t, res.Query, "")
+			// Must not affect other callers
+			for i := range res.Body {
+				res.Body[i] = 0
+			}
+			res.Body = nil
+			res.Host = ""
+			mu.Lock()
+			seen[t.Name()] = true
+			mu.Unlock()
+		})
+	})
+	st.Expect(t, len(seen), len(c.Entries(Whois())))
+	st.Expect(t, seen["TestRun/all/whois.kr/google.kr"], true)
+	for _, e := range c.Entries() {
+		st.Refute(t, e.Host, "")
+		st.Expect(t, string(e.Body), bodies[e.Path])
+	}
+}
+
+func TestFS(t *testing.T) {
+	fns, err := ResponseFiles()
+	st.Assert(t, err, nil)
+	names, err := ResponseFilesFS(FS())
+	st.Assert(t, err, nil)
+	st.Expect(t, len(names), len(fns))
+
+	name := ResponsePath("google.com", "whois.verisign-grs.com")
+	st.Expect(t, name, "whois.verisign-grs.com/google.com.mime")
+	f, err := FS().Open(name)
+	st.Assert(t, err, nil)
+	defer f.Close()
+	res, err := whois.ReadMIME(f)
+	st.Assert(t, err, nil)
+	st.Expect(t, res.Query, "google.com")
+
+	_, err = fs.Stat(Testdata(), "prefixes.txt")
+	st.Expect(t, err, nil)
+}
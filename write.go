@@ -0,0 +1,65 @@
+package whoistest
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/domainr/whois"
+)
+
+// WriteResponseFile writes res in MIME format to fn, creating its directory
+// if needed. The file is written to a temporary file in the same directory,
+// synced and renamed into place only if every write succeeds, so fn is
+// never left partially written.
+func WriteResponseFile(fn string, res *whois.Response) error {
+	return writeFileAtomic(fn, res.WriteMIME)
+}
+
+// writeFileAtomic calls write with a temporary file in the directory of fn,
+// then syncs it and renames it to fn. The temporary file is removed if any
+// step fails.
+func writeFileAtomic(fn string, write func(io.Writer) error) (err error) {
+	dir := filepath.Dir(fn)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, "."+filepath.Base(fn)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	w := bufio.NewWriter(f)
+	if err = write(w); err != nil {
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	if err = f.Chmod(0644); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(f.Name(), fn); err != nil {
+		return err
+	}
+
+	// Persist the rename; not all platforms can sync directories
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package whoistest
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/domainr/whois"
+	"github.com/nbio/st"
+)
+
+func TestWriteResponseFile(t *testing.T) {
+	res := whois.NewResponse("example.com", "whois.example.com")
+	res.Body = []byte("Domain Name: EXAMPLE.COM\r\n")
+	dir := t.TempDir()
+	fn := filepath.Join(dir, filepath.FromSlash(ResponsePath(res.Query, res.Host)))
+	st.Assert(t, WriteResponseFile(fn, res), nil)
+
+	got, err := whois.ReadMIMEFile(fn)
+	st.Assert(t, err, nil)
+	st.Expect(t, string(got.Body), string(res.Body))
+	ms, err := VerifyFile(fn)
+	st.Assert(t, err, nil)
+	st.Expect(t, len(ms), 0)
+	fi, err := os.Stat(fn)
+	st.Assert(t, err, nil)
+	st.Expect(t, fi.Mode().Perm(), os.FileMode(0644))
+}
+
+func TestWriteFileAtomicError(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "a.mime")
+	st.Assert(t, os.WriteFile(fn, []byte("original"), 0644), nil)
+
+	errWrite := errors.New("disk full")
+	err := writeFileAtomic(fn, func(w io.Writer) error {
+		w.Write([]byte("partial"))
+		return errWrite
+	})
+	st.Expect(t, err, errWrite)
+
+	// The original is intact and no temporary file is left behind
+	b, err := os.ReadFile(fn)
+	st.Assert(t, err, nil)
+	st.Expect(t, string(b), "original")
+	entries, err := os.ReadDir(dir)
+	st.Assert(t, err, nil)
+	st.Expect(t, len(entries), 1)
+}